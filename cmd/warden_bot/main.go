@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// Chat timezones do not depend on tzdata in the image
+	_ "time/tzdata"
 
 	postrgesql "github.com/g3ksa/warden_bot/internal/tools/database/postgresql"
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service/storage"
 
 	"github.com/g3ksa/warden_bot/internal/warden_bot/config"
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/classifier"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/state"
 	"github.com/go-co-op/gocron"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
@@ -50,8 +56,60 @@ func main() {
 	bot.Debug = false
 	slog.Info("Authorized on account:", slog.String("username", bot.Self.UserName))
 
+	callbackSecret := cfg.CallbackSecret
+	if callbackSecret == "" {
+		callbackSecret = cfg.BotToken
+	}
+
+	serviceConfig := service.Config{
+		BatchSize:      cfg.Classifier.BatchSize,
+		Concurrency:    cfg.Classifier.Concurrency,
+		MinConfidence:  cfg.Classifier.MinConfidence,
+		CallbackSecret: callbackSecret,
+		BotID:          bot.Self.ID,
+	}
+	if cfg.State.Store == "postgres" {
+		serviceConfig.State = state.NewDBState(db, cfg.State.TTL)
+	} else {
+		serviceConfig.State = state.NewBotState(cfg.State.TTL)
+	}
+	if cfg.UpdateMode == service.UpdateModeWebhook {
+		if cfg.WebhookSecret == "" {
+			log.Panic("webhook_secret is required in webhook mode")
+		}
+		serviceConfig.Webhook = &service.WebhookConfig{
+			HttpAddr: cfg.HttpAddr,
+			Path:     cfg.WebhookPath,
+			Secret:   cfg.WebhookSecret,
+		}
+	}
+
+	messageClassifier, err := newClassifier(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	dbStorage := storage.NewDBStorage(db)
-	wardenBotservice := service.NewWardenBotService(cfg.ModelServiceURL, bot, dbStorage)
+	wardenBotservice := service.NewWardenBotService(messageClassifier, bot, dbStorage, serviceConfig)
+
+	if cfg.Backfill != nil {
+		slog.Info("Backfill started", slog.Time("from", cfg.Backfill.From), slog.Time("to", cfg.Backfill.To))
+		if err := wardenBotservice.Backfill(ctx, cfg.Backfill.ChatID, cfg.Backfill.From, cfg.Backfill.To); err != nil {
+			slog.Error(err.Error())
+			cancel()
+			os.Exit(1)
+		}
+		cancel()
+		return
+	}
+
+	if serviceConfig.Webhook != nil {
+		if err := setWebhook(bot, cfg.WebhookURL, cfg.WebhookSecret); err != nil {
+			log.Panic(err)
+		}
+	} else if _, err := bot.RemoveWebhook(); err != nil {
+		slog.Error(err.Error())
+	}
 
 	cron := gocron.NewScheduler(time.Local)
 	scheduler := cron.Cron(cfg.CronSchedule)
@@ -70,25 +128,87 @@ func main() {
 
 	cron.StartAsync()
 
+	updatesErr := make(chan error, 1)
 	go func() {
-		err := wardenBotservice.ProcessUpdatesFromBot(ctx)
-		if err != nil {
-			log.Panic(err)
-		}
+		updatesErr <- wardenBotservice.ProcessUpdatesFromBot(ctx)
 	}()
 
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-	sig := <-signalChan
-	slog.Info("Received signal", sig)
+	exitCode := 0
+	select {
+	case sig := <-signalChan:
+		slog.Info("Received signal", slog.String("signal", sig.String()))
+	case err := <-updatesErr:
+		// Exiting lets the supervisor restart the bot from the last committed update
+		if err != nil {
+			slog.Error("Stopped processing updates", slog.String("error", err.Error()))
+			exitCode = 1
+		}
+	}
 
 	cancel()
 	cron.Stop()
+	os.Exit(exitCode)
+}
+
+func newClassifier(cfg *config.WardenBotConfig) (classifier.Classifier, error) {
+	rules := classifier.DefaultRules
+	if len(cfg.Classifier.Rules) > 0 {
+		rules = make([]classifier.Rule, 0, len(cfg.Classifier.Rules))
+		for _, rule := range cfg.Classifier.Rules {
+			rules = append(rules, classifier.Rule{Pattern: rule.Pattern, Category: rule.Category})
+		}
+	}
+
+	httpClassifier := classifier.NewHTTPClassifier(cfg.ModelServiceURL, nil, classifier.HTTPConfig{
+		Timeout:        cfg.Classifier.Timeout,
+		MaxRetries:     cfg.Classifier.MaxRetries,
+		InitialBackoff: cfg.Classifier.InitialBackoff,
+		MaxBackoff:     cfg.Classifier.MaxBackoff,
+	})
+
+	switch cfg.Classifier.Type {
+	case classifier.TypeHTTP, "":
+		return httpClassifier, nil
+	case classifier.TypeRules:
+		return classifier.NewRuleClassifier(rules, cfg.Classifier.DefaultCategory, cfg.Classifier.RuleConfidence)
+	case classifier.TypeFallback:
+		ruleClassifier, err := classifier.NewRuleClassifier(rules, cfg.Classifier.DefaultCategory, cfg.Classifier.RuleConfidence)
+		if err != nil {
+			return nil, err
+		}
+		return classifier.NewFallbackClassifier(httpClassifier, ruleClassifier), nil
+	default:
+		return nil, fmt.Errorf("unknown classifier type: %s", cfg.Classifier.Type)
+	}
+}
+
+// setWebhook registers the public webhook URL; an empty URL leaves the registration to an external tool.
+func setWebhook(bot *tgbotapi.BotAPI, webhookURL, secret string) error {
+	if webhookURL == "" {
+		return nil
+	}
+
+	params := url.Values{}
+	params.Add("url", webhookURL)
+	if secret != "" {
+		params.Add("secret_token", secret)
+	}
+
+	if _, err := bot.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	return nil
 }
 
 func run(ctx context.Context, service *service.WardenBotService) error {
-	if err := service.ProcessMessages(ctx); err != nil {
+	err := service.ProcessMessages(ctx)
+	// Subscriptions are dispatched after classification, so their reports cover the classified messages.
+	// They are dispatched even if some chats failed, their reports show unclassified messages.
+	err = errors.Join(err, service.DispatchSubscriptions(ctx, time.Now()))
+	if err != nil {
 		slog.Error(err.Error())
 		return err
 	}
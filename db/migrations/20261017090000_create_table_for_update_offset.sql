@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "update_offsets" (
+    id INTEGER PRIMARY KEY,
+    update_id BIGINT NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "update_offsets";
+-- +goose StatementEnd
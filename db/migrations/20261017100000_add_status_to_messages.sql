@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Messages stored before this migration have already been through the classifier
+ALTER TABLE "messages" ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'classified';
+
+ALTER TABLE "messages" ALTER COLUMN status SET DEFAULT 'pending';
+
+CREATE INDEX IF NOT EXISTS messages_chat_id_status_idx ON "messages" (chat_id, status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS messages_chat_id_status_idx;
+
+ALTER TABLE "messages" DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "messages" ADD COLUMN category VARCHAR(32);
+
+ALTER TABLE "messages" ADD COLUMN confidence REAL NOT NULL DEFAULT 1;
+
+UPDATE "messages" SET category = CASE WHEN label = 1 THEN 'work' ELSE 'off_topic' END WHERE status = 'classified';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "messages" DROP COLUMN IF EXISTS confidence;
+
+ALTER TABLE "messages" DROP COLUMN IF EXISTS category;
+-- +goose StatementEnd
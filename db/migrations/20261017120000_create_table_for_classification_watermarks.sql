@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "classification_watermarks" (
+    chat_id BIGINT PRIMARY KEY REFERENCES "chats" (chat_id) ON DELETE CASCADE,
+    classified_until TIMESTAMP NOT NULL,
+    message_id INTEGER NOT NULL
+);
+
+-- Start from the last message that has already been classified
+INSERT INTO "classification_watermarks" (chat_id, classified_until, message_id)
+SELECT DISTINCT ON (chat_id) chat_id, date, message_id
+FROM "messages"
+WHERE status = 'classified'
+ORDER BY chat_id, date DESC, message_id DESC;
+
+CREATE INDEX IF NOT EXISTS messages_chat_id_date_idx ON "messages" (chat_id, date, message_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS messages_chat_id_date_idx;
+
+DROP TABLE IF EXISTS "classification_watermarks";
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "conversations" (
+    user_id BIGINT PRIMARY KEY,
+    step VARCHAR(50) NOT NULL,
+    chat_id BIGINT NOT NULL DEFAULT 0,
+    date_from TIMESTAMP NOT NULL,
+    date_to TIMESTAMP NOT NULL,
+    format VARCHAR(20) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS conversations_expires_at_idx ON "conversations" (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "conversations";
+-- +goose StatementEnd
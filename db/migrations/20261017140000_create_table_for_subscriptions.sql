@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "subscriptions" (
+    user_id BIGINT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    private_chat_id BIGINT NOT NULL,
+    frequency VARCHAR(20) NOT NULL,
+    send_at VARCHAR(5) NOT NULL,
+    last_sent_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chat_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "subscriptions";
+-- +goose StatementEnd
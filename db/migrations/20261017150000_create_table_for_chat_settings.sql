@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "chat_settings" (
+    chat_id BIGINT PRIMARY KEY,
+    high_productivity_below DOUBLE PRECISION NOT NULL DEFAULT 20,
+    low_productivity_above DOUBLE PRECISION NOT NULL DEFAULT 50,
+    sample_limit INTEGER NOT NULL DEFAULT 10,
+    top_users_limit INTEGER NOT NULL DEFAULT 10,
+    high_label VARCHAR(255) NOT NULL DEFAULT '',
+    normal_label VARCHAR(255) NOT NULL DEFAULT '',
+    low_label VARCHAR(255) NOT NULL DEFAULT ''
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "chat_settings";
+-- +goose StatementEnd
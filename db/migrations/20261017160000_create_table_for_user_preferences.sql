@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "user_preferences" (
+    user_id BIGINT PRIMARY KEY,
+    locale VARCHAR(10) NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "user_preferences";
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The period is stored as the command argument and resolved in the timezone of the selected chat
+DELETE FROM "conversations";
+ALTER TABLE "conversations" DROP COLUMN IF EXISTS date_from;
+ALTER TABLE "conversations" DROP COLUMN IF EXISTS date_to;
+ALTER TABLE "conversations" ADD COLUMN IF NOT EXISTS period VARCHAR(30) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM "conversations";
+ALTER TABLE "conversations" DROP COLUMN IF EXISTS period;
+ALTER TABLE "conversations" ADD COLUMN IF NOT EXISTS date_from TIMESTAMP NOT NULL;
+ALTER TABLE "conversations" ADD COLUMN IF NOT EXISTS date_to TIMESTAMP NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "users" (
+    user_id BIGINT PRIMARY KEY,
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    full_name VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Messages saved before the column existed keep user_id = 0 and are grouped by name
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS user_id BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "messages" DROP COLUMN IF EXISTS user_id;
+DROP TABLE IF EXISTS "users";
+-- +goose StatementEnd
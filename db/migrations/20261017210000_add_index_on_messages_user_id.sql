@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS messages_user_id_chat_id_date_idx ON "messages" (user_id, chat_id, date);
+CREATE INDEX IF NOT EXISTS users_username_idx ON "users" (LOWER(username));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_username_idx;
+DROP INDEX IF EXISTS messages_user_id_chat_id_date_idx;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "message_revisions" (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    text VARCHAR NOT NULL,
+    edited_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS message_revisions_chat_id_message_id_idx ON "message_revisions" (chat_id, message_id, edited_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "message_revisions";
+-- +goose StatementEnd
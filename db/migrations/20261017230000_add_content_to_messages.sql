@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Messages saved before the columns existed are treated as text without replies and forwards
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS content_type VARCHAR(20) NOT NULL DEFAULT 'text';
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS caption VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS entities VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS reply_to_message_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS forward_from_user_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS forward_from_chat_id BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE "message_revisions" ADD COLUMN IF NOT EXISTS caption VARCHAR NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "message_revisions" DROP COLUMN IF EXISTS caption;
+
+ALTER TABLE "messages" DROP COLUMN IF EXISTS forward_from_chat_id;
+ALTER TABLE "messages" DROP COLUMN IF EXISTS forward_from_user_id;
+ALTER TABLE "messages" DROP COLUMN IF EXISTS reply_to_message_id;
+ALTER TABLE "messages" DROP COLUMN IF EXISTS entities;
+ALTER TABLE "messages" DROP COLUMN IF EXISTS caption;
+ALTER TABLE "messages" DROP COLUMN IF EXISTS content_type;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The thread of previously saved messages is unknown, they belong to the main flow
+ALTER TABLE "messages" ADD COLUMN IF NOT EXISTS thread_id BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE "conversations" ADD COLUMN IF NOT EXISTS thread_id BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "conversations" DROP COLUMN IF EXISTS thread_id;
+ALTER TABLE "messages" DROP COLUMN IF EXISTS thread_id;
+-- +goose StatementEnd
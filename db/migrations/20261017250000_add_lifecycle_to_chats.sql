@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "chats" ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE;
+-- The history of a group upgraded to a supergroup stays under the old chat_id
+ALTER TABLE "chats" ADD COLUMN IF NOT EXISTS migrated_to_chat_id BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS chats_migrated_to_chat_id_idx ON "chats" (migrated_to_chat_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS chats_migrated_to_chat_id_idx;
+ALTER TABLE "chats" DROP COLUMN IF EXISTS migrated_to_chat_id;
+ALTER TABLE "chats" DROP COLUMN IF EXISTS active;
+-- +goose StatementEnd
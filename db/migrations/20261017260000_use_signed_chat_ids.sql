@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Group chats used to be stored under the absolute Telegram ID, the sign is restored from the chat type
+ALTER TABLE "messages" DROP CONSTRAINT IF EXISTS fk_chat;
+ALTER TABLE "classification_watermarks" DROP CONSTRAINT IF EXISTS classification_watermarks_chat_id_fkey;
+
+UPDATE "messages" SET chat_id = -chat_id
+WHERE chat_id IN (SELECT chat_id FROM "chats" WHERE type <> 'private');
+UPDATE "message_revisions" SET chat_id = -chat_id
+WHERE chat_id IN (SELECT chat_id FROM "chats" WHERE type <> 'private');
+UPDATE "classification_watermarks" SET chat_id = -chat_id
+WHERE chat_id IN (SELECT chat_id FROM "chats" WHERE type <> 'private');
+UPDATE "chat_settings" SET chat_id = -chat_id
+WHERE chat_id IN (SELECT chat_id FROM "chats" WHERE type <> 'private');
+UPDATE "subscriptions" SET chat_id = -chat_id
+WHERE chat_id IN (SELECT chat_id FROM "chats" WHERE type <> 'private');
+UPDATE "conversations" SET chat_id = -chat_id
+WHERE chat_id IN (SELECT chat_id FROM "chats" WHERE type <> 'private');
+UPDATE "chats" SET migrated_to_chat_id = -migrated_to_chat_id WHERE migrated_to_chat_id > 0;
+UPDATE "chats" SET chat_id = -chat_id WHERE type <> 'private' AND chat_id > 0;
+
+ALTER TABLE "messages" ADD CONSTRAINT fk_chat FOREIGN KEY (chat_id) REFERENCES "chats" (chat_id) ON DELETE CASCADE;
+ALTER TABLE "classification_watermarks" ADD CONSTRAINT classification_watermarks_chat_id_fkey
+    FOREIGN KEY (chat_id) REFERENCES "chats" (chat_id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "messages" DROP CONSTRAINT IF EXISTS fk_chat;
+ALTER TABLE "classification_watermarks" DROP CONSTRAINT IF EXISTS classification_watermarks_chat_id_fkey;
+
+UPDATE "messages" SET chat_id = -chat_id WHERE chat_id < 0;
+UPDATE "message_revisions" SET chat_id = -chat_id WHERE chat_id < 0;
+UPDATE "classification_watermarks" SET chat_id = -chat_id WHERE chat_id < 0;
+UPDATE "chat_settings" SET chat_id = -chat_id WHERE chat_id < 0;
+UPDATE "subscriptions" SET chat_id = -chat_id WHERE chat_id < 0;
+UPDATE "conversations" SET chat_id = -chat_id WHERE chat_id < 0;
+UPDATE "chats" SET migrated_to_chat_id = -migrated_to_chat_id WHERE migrated_to_chat_id < 0;
+UPDATE "chats" SET chat_id = -chat_id WHERE chat_id < 0;
+
+ALTER TABLE "messages" ADD CONSTRAINT fk_chat FOREIGN KEY (chat_id) REFERENCES "chats" (chat_id) ON DELETE CASCADE;
+ALTER TABLE "classification_watermarks" ADD CONSTRAINT classification_watermarks_chat_id_fkey
+    FOREIGN KEY (chat_id) REFERENCES "chats" (chat_id) ON DELETE CASCADE;
+-- +goose StatementEnd
@@ -24,7 +24,7 @@ func NewConfig(v *viper.Viper, configFile string) (*config, error) {
 	viper.AutomaticEnv()
 
 	if err := v.ReadInConfig(); err != nil {
-		slog.Error("failed to read a config file on <NewConfig>: %v", err)
+		slog.Error("failed to read a config file on <NewConfig>", slog.String("error", err.Error()))
 		return nil, ErrConfig
 	}
 
@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/g3ksa/warden_bot/internal/config"
 	"github.com/spf13/viper"
@@ -11,10 +12,50 @@ import (
 type WardenBotConfig struct {
 	CronSchedule    string
 	HttpAddr        string
+	UpdateMode      string
+	WebhookURL      string
+	WebhookPath     string
+	WebhookSecret   string
+	CallbackSecret  string
 	ModelServiceURL string
 	BotToken        string
 	RunImmediate    bool
 	Database        config.Database
+	Classifier      Classifier
+	State           State
+	// Backfill is set when the service is started to reclassify a historical range and exit
+	Backfill *Backfill
+}
+
+type State struct {
+	// Store is memory or postgres
+	Store string
+	TTL   time.Duration
+}
+
+type Backfill struct {
+	ChatID int64
+	From   time.Time
+	To     time.Time
+}
+
+type Classifier struct {
+	Type            string
+	DefaultCategory string
+	Rules           []ClassifierRule
+	MinConfidence   float64
+	RuleConfidence  float64
+	BatchSize       int
+	Concurrency     int
+	Timeout         time.Duration
+	MaxRetries      int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+}
+
+type ClassifierRule struct {
+	Pattern  string `mapstructure:"pattern"`
+	Category string `mapstructure:"category"`
 }
 
 func NewWardenBotConfig() (*WardenBotConfig, error) {
@@ -23,19 +64,85 @@ func NewWardenBotConfig() (*WardenBotConfig, error) {
 	configPath := "config/warden_bot.yaml"
 
 	run := flag.Bool("run", false, "generate sitemaps immediately")
+	backfillFrom := flag.String("backfill-from", "", "reclassify messages starting from this date (YYYY-MM-DD) and exit")
+	backfillTo := flag.String("backfill-to", "", "last date (YYYY-MM-DD) to reclassify, today by default")
+	backfillChat := flag.Int64("backfill-chat", 0, "Telegram ID of the chat to reclassify, e.g. -1001234567890, all group chats by default")
 	flag.Parse()
 
+	backfill, err := newBackfill(*backfillFrom, *backfillTo, *backfillChat)
+	if err != nil {
+		return nil, err
+	}
+
 	baseConfig, err := config.NewConfig(v, configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create config: %v", err)
 	}
 
+	var rules []ClassifierRule
+	if err := v.UnmarshalKey("classifier.rules", &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse classifier rules: %v", err)
+	}
+
 	return &WardenBotConfig{
 		CronSchedule:    v.GetString("service.cron_schedule"),
 		HttpAddr:        v.GetString("service.http_addr"),
+		UpdateMode:      v.GetString("service.update_mode"),
+		WebhookURL:      v.GetString("service.webhook_url"),
+		WebhookPath:     v.GetString("service.webhook_path"),
+		WebhookSecret:   v.GetString("service.webhook_secret"),
+		CallbackSecret:  v.GetString("service.callback_secret"),
 		ModelServiceURL: v.GetString("service.model_service_url"),
 		BotToken:        v.GetString("service.bot_token"),
 		RunImmediate:    *run,
+		Backfill:        backfill,
 		Database:        *baseConfig.NewDatabase(),
+		Classifier: Classifier{
+			Type:            v.GetString("classifier.type"),
+			DefaultCategory: v.GetString("classifier.default_category"),
+			Rules:           rules,
+			MinConfidence:   v.GetFloat64("classifier.min_confidence"),
+			RuleConfidence:  v.GetFloat64("classifier.rule_confidence"),
+			BatchSize:       v.GetInt("classifier.batch_size"),
+			Concurrency:     v.GetInt("classifier.concurrency"),
+			Timeout:         v.GetDuration("classifier.timeout"),
+			MaxRetries:      v.GetInt("classifier.max_retries"),
+			InitialBackoff:  v.GetDuration("classifier.initial_backoff"),
+			MaxBackoff:      v.GetDuration("classifier.max_backoff"),
+		},
+		State: State{
+			Store: v.GetString("state.store"),
+			TTL:   v.GetDuration("state.ttl"),
+		},
+	}, nil
+}
+
+func newBackfill(from, to string, chatID int64) (*Backfill, error) {
+	if from == "" {
+		return nil, nil
+	}
+
+	fromDate, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backfill-from date: %v", err)
+	}
+
+	toDate := time.Now().Truncate(24 * time.Hour)
+	if to != "" {
+		toDate, err = time.Parse(time.DateOnly, to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backfill-to date: %v", err)
+		}
+	}
+
+	if toDate.Before(fromDate) {
+		return nil, fmt.Errorf("backfill-to %s is before backfill-from %s", to, from)
+	}
+
+	return &Backfill{
+		ChatID: chatID,
+		From:   fromDate,
+		// The last day is inclusive
+		To: toDate.AddDate(0, 0, 1),
 	}, nil
 }
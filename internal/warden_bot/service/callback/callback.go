@@ -0,0 +1,60 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	separator = ":"
+	// signatureSize keeps callback data within Telegram's 64 byte limit
+	signatureSize = 8
+)
+
+var (
+	ErrMalformed        = errors.New("malformed callback data")
+	ErrInvalidSignature = errors.New("invalid callback data signature")
+)
+
+// Signer signs inline keyboard callback data for a particular user, so forged or
+// forwarded buttons are rejected.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(secret string) *Signer {
+	return &Signer{key: []byte(secret)}
+}
+
+// Sign returns "action:arg1:...:signature". Neither action nor args may contain ":".
+func (s *Signer) Sign(userID int, action string, args ...string) string {
+	payload := strings.Join(append([]string{action}, args...), separator)
+	return payload + separator + s.signature(userID, payload)
+}
+
+func (s *Signer) Verify(userID int, data string) (string, []string, error) {
+	i := strings.LastIndex(data, separator)
+	if i <= 0 {
+		return "", nil, ErrMalformed
+	}
+
+	payload, signature := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.signature(userID, payload))) {
+		return "", nil, ErrInvalidSignature
+	}
+
+	parts := strings.Split(payload, separator)
+	return parts[0], parts[1:], nil
+}
+
+func (s *Signer) signature(userID int, payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strconv.Itoa(userID)))
+	mac.Write([]byte(separator))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureSize])
+}
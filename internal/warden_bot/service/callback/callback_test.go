@@ -0,0 +1,31 @@
+package callback
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner("secret")
+
+	data := signer.Sign(7, "day", "1001234567890", "2026-09-30")
+	assert.LessOrEqual(t, len(data), 64)
+
+	action, args, err := signer.Verify(7, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "day", action)
+	assert.Equal(t, []string{"1001234567890", "2026-09-30"}, args)
+
+	_, _, err = signer.Verify(8, data)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, _, err = NewSigner("other").Verify(7, data)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, _, err = signer.Verify(7, "day:1:2026-09-30:forged")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, _, err = signer.Verify(7, "noop")
+	assert.ErrorIs(t, err, ErrMalformed)
+}
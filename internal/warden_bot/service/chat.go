@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// handleChatEvent applies service messages about the chat itself and reports whether the message was one.
+// Such messages are not stored, a new title is already saved with the chat info of every message.
+func (s *WardenBotService) handleChatEvent(ctx context.Context, message *tgbotapi.Message) (bool, error) {
+	chatID := message.Chat.ID
+
+	switch {
+	// Both migration messages arrive in different chats, handling them is idempotent
+	case message.MigrateToChatID != 0:
+		return true, s.storage.MigrateChat(ctx, chatID, message.MigrateToChatID)
+	case message.MigrateFromChatID != 0:
+		return true, s.storage.MigrateChat(ctx, message.MigrateFromChatID, chatID)
+	case message.LeftChatMember != nil:
+		if message.LeftChatMember.ID == s.botID {
+			return true, s.storage.DeactivateChat(ctx, chatID)
+		}
+		return true, nil
+	case message.NewChatMembers != nil, message.NewChatTitle != "":
+		return true, nil
+	}
+	return false, nil
+}
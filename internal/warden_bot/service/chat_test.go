@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleChatEvent(t *testing.T) {
+	ctx := context.Background()
+	botID := 99
+
+	groupMessage := func(chatID int64, chatType string) *tgbotapi.Message {
+		return &tgbotapi.Message{
+			MessageID: 1,
+			From:      &tgbotapi.User{ID: 7, FirstName: "John"},
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: chatType, Title: "Team chat"},
+		}
+	}
+
+	t.Run("Migration to supergroup", func(t *testing.T) {
+		mockStorage, _, wardenBotService := setupTest()
+
+		message := groupMessage(-1001234567890, "supergroup")
+		message.MigrateFromChatID = -123
+		mockStorage.On("SaveChatInfo", ctx, &model.Chat{ChatID: -1001234567890, Title: "Team chat", Type: "supergroup", Active: true}).Return(nil)
+		mockStorage.On("MigrateChat", ctx, int64(-123), int64(-1001234567890)).Return(nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: message})
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockStorage.AssertNotCalled(t, "PutMessage", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Migration from group", func(t *testing.T) {
+		mockStorage, _, wardenBotService := setupTest()
+
+		message := groupMessage(-123, "group")
+		message.MigrateToChatID = -1001234567890
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("MigrateChat", ctx, int64(-123), int64(-1001234567890)).Return(nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: message})
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Bot removed", func(t *testing.T) {
+		mockStorage, _, wardenBotService := setupTest()
+		wardenBotService.botID = botID
+
+		message := groupMessage(-123, "group")
+		message.LeftChatMember = &tgbotapi.User{ID: botID}
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("DeactivateChat", ctx, int64(-123)).Return(nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: message})
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Member left", func(t *testing.T) {
+		mockStorage, _, wardenBotService := setupTest()
+		wardenBotService.botID = botID
+
+		message := groupMessage(-123, "group")
+		message.LeftChatMember = &tgbotapi.User{ID: 8}
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: message})
+		assert.NoError(t, err)
+
+		mockStorage.AssertNotCalled(t, "DeactivateChat", mock.Anything, mock.Anything)
+		mockStorage.AssertNotCalled(t, "PutMessage", mock.Anything, mock.Anything)
+	})
+
+	t.Run("New title", func(t *testing.T) {
+		mockStorage, _, wardenBotService := setupTest()
+
+		message := groupMessage(-123, "group")
+		message.Chat.Title = "Renamed chat"
+		message.NewChatTitle = "Renamed chat"
+		mockStorage.On("SaveChatInfo", ctx, &model.Chat{ChatID: -123, Title: "Renamed chat", Type: "group", Active: true}).Return(nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: message})
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockStorage.AssertNotCalled(t, "PutMessage", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,50 @@
+package classifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+const (
+	TypeHTTP     = "http"
+	TypeRules    = "rules"
+	TypeFallback = "fallback"
+)
+
+var ErrNoClassifiers = errors.New("no classifiers configured")
+
+type Classifier interface {
+	Classify(ctx context.Context, messages []model.MessageRequest) ([]model.ClassifiedMessage, error)
+}
+
+// FallbackClassifier asks classifiers in order and returns the first successful answer.
+type FallbackClassifier struct {
+	classifiers []Classifier
+}
+
+func NewFallbackClassifier(classifiers ...Classifier) *FallbackClassifier {
+	return &FallbackClassifier{classifiers: classifiers}
+}
+
+func (c *FallbackClassifier) Classify(ctx context.Context, messages []model.MessageRequest) ([]model.ClassifiedMessage, error) {
+	if len(c.classifiers) == 0 {
+		return nil, ErrNoClassifiers
+	}
+
+	var errs []error
+	for i, classifier := range c.classifiers {
+		classified, err := classifier.Classify(ctx, messages)
+		if err == nil {
+			return classified, nil
+		}
+
+		slog.Error("classifier failed, falling back", slog.Int("index", i), slog.String("error", err.Error()))
+		errs = append(errs, err)
+	}
+
+	return nil, fmt.Errorf("all classifiers failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,152 @@
+package classifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingClassifier struct{}
+
+func (failingClassifier) Classify(ctx context.Context, messages []model.MessageRequest) ([]model.ClassifiedMessage, error) {
+	return nil, errors.New("model service is down")
+}
+
+func TestRuleClassifier(t *testing.T) {
+	ctx := context.Background()
+
+	classifier, err := NewRuleClassifier(DefaultRules, "", 0)
+	assert.NoError(t, err)
+
+	classified, err := classifier.Classify(ctx, []model.MessageRequest{
+		{MessageID: 1, ChatID: -10, Text: "Кто возьмёт задачу по релизу?"},
+		{MessageID: 2, ChatID: -10, Text: "Please review my PR"},
+		{MessageID: 3, ChatID: -10, Text: "Смотрите, какой котик"},
+		{MessageID: 4, ChatID: -10, Text: "Кто идет обедать?"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1, 1, 0, 1}, []uint{classified[0].Label, classified[1].Label, classified[2].Label, classified[3].Label})
+	assert.Equal(t, model.CategoryOffTopic, classified[2].Category)
+	assert.Equal(t, model.CategoryQuestion, classified[3].Category)
+	assert.Equal(t, int64(-10), classified[2].ChatID)
+	// Keyword guesses are reported as uncertain by default
+	assert.NotNil(t, classified[0].Confidence)
+	assert.Equal(t, DefaultRuleConfidence, *classified[0].Confidence)
+
+	confident, err := NewRuleClassifier(DefaultRules, "", 0.9)
+	assert.NoError(t, err)
+	classified, err = confident.Classify(ctx, []model.MessageRequest{{MessageID: 1, ChatID: -10, Text: "Please review my PR"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.9, *classified[0].Confidence)
+
+	_, err = NewRuleClassifier([]Rule{{Pattern: "("}}, "", 0)
+	assert.Error(t, err)
+}
+
+func TestHTTPClassifier(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Success", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/classify", r.URL.Path)
+
+			var request model.MessagesRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+			response := model.ClassifiedMessagesResponse{}
+			for _, msg := range request.Messages {
+				response.Messages = append(response.Messages, model.ClassifiedMessage{MessageID: msg.MessageID, ChatID: msg.ChatID, Label: 1})
+			}
+			json.NewEncoder(w).Encode(response)
+		}))
+		defer server.Close()
+
+		classified, err := NewHTTPClassifier(server.URL, nil, HTTPConfig{}).Classify(ctx, []model.MessageRequest{{MessageID: 1, ChatID: -2, Text: "text"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.ClassifiedMessage{{MessageID: 1, ChatID: -2, Label: 1}}, classified)
+	})
+
+	t.Run("Non-200 status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		_, err := NewHTTPClassifier(server.URL, nil, HTTPConfig{}).Classify(ctx, []model.MessageRequest{{MessageID: 1}})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "non-200 status")
+	})
+
+	t.Run("Retries 5xx", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(model.ClassifiedMessagesResponse{Messages: []model.ClassifiedMessage{{MessageID: 1, Label: 1}}})
+		}))
+		defer server.Close()
+
+		classifier := NewHTTPClassifier(server.URL, nil, HTTPConfig{MaxRetries: 3, InitialBackoff: time.Millisecond})
+		classified, err := classifier.Classify(ctx, []model.MessageRequest{{MessageID: 1}})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, uint(1), classified[0].Label)
+	})
+
+	t.Run("Does not retry 4xx", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		classifier := NewHTTPClassifier(server.URL, nil, HTTPConfig{MaxRetries: 3, InitialBackoff: time.Millisecond})
+		_, err := classifier.Classify(ctx, []model.MessageRequest{{MessageID: 1}})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		classifier := NewHTTPClassifier(server.URL, nil, HTTPConfig{Timeout: 10 * time.Millisecond, MaxRetries: 1, InitialBackoff: time.Millisecond})
+		_, err := classifier.Classify(ctx, []model.MessageRequest{{MessageID: 1}})
+		assert.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestFallbackClassifier(t *testing.T) {
+	ctx := context.Background()
+	messages := []model.MessageRequest{{MessageID: 1, ChatID: -2, Text: "deploy is broken"}}
+
+	ruleClassifier, err := NewRuleClassifier(DefaultRules, "", 0)
+	assert.NoError(t, err)
+
+	classified, err := NewFallbackClassifier(failingClassifier{}, ruleClassifier).Classify(ctx, messages)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), classified[0].Label)
+
+	_, err = NewFallbackClassifier(failingClassifier{}, failingClassifier{}).Classify(ctx, messages)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "model service is down")
+
+	_, err = NewFallbackClassifier().Classify(ctx, messages)
+	assert.ErrorIs(t, err, ErrNoClassifiers)
+}
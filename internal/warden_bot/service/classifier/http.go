@@ -0,0 +1,128 @@
+package classifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+type HTTPConfig struct {
+	// Timeout bounds a single request attempt, 0 means only the caller's context applies
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts after a network error or a 5xx response
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// HTTPClassifier sends messages to the model service /classify endpoint.
+type HTTPClassifier struct {
+	modelServiceUrl string
+	client          *http.Client
+	cfg             HTTPConfig
+}
+
+// retryableError marks failures that may succeed on the next attempt.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func NewHTTPClassifier(modelServiceUrl string, client *http.Client, cfg HTTPConfig) *HTTPClassifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPClassifier{
+		modelServiceUrl: modelServiceUrl,
+		client:          client,
+		cfg:             cfg,
+	}
+}
+
+func (c *HTTPClassifier) Classify(ctx context.Context, messages []model.MessageRequest) ([]model.ClassifiedMessage, error) {
+	requestBody := model.MessagesRequest{Messages: messages}
+	requestJSON, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	backoff := c.cfg.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		classified, err := c.classify(ctx, requestJSON)
+
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= c.cfg.MaxRetries {
+			return classified, err
+		}
+
+		slog.Warn("classification request failed, retrying",
+			slog.Int("attempt", attempt+1),
+			slog.Duration("backoff", backoff),
+			slog.String("error", err.Error()),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("classification retry aborted: %w", errors.Join(ctx.Err(), err))
+		}
+
+		backoff *= 2
+		if c.cfg.MaxBackoff > 0 && backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+func (c *HTTPClassifier) classify(ctx context.Context, requestJSON []byte) ([]model.ClassifiedMessage, error) {
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.modelServiceUrl+"/classify", bytes.NewReader(requestJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create classification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to send classification request: %w", err)
+		if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, err
+		}
+		return nil, &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("classification API returned non-200 status: %s", resp.Status)
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, &retryableError{err: err}
+		}
+		return nil, err
+	}
+
+	var classifiedResponse model.ClassifiedMessagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&classifiedResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode classification response: %w", err)
+	}
+
+	return classifiedResponse.Messages, nil
+}
@@ -0,0 +1,88 @@
+package classifier
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+type Rule struct {
+	Pattern  string
+	Category string
+}
+
+// DefaultRules mark messages about everyday work as work and the rest of messages ending with "?" as questions.
+var DefaultRules = []Rule{
+	{Pattern: `задач|тикет|баг|ошибк|релиз|деплой|ревью|мерж|ветк|сборк|тест|созвон|встреч|дедлайн|срок`, Category: model.CategoryWork},
+	{Pattern: `\b(task|ticket|bug|issue|release|deploy|review|merge|branch|build|test|meeting|deadline|pr|mr)\b`, Category: model.CategoryWork},
+	{Pattern: `\?\s*$`, Category: model.CategoryQuestion},
+}
+
+// DefaultRuleConfidence keeps keyword guesses below the default minimal confidence of reports,
+// so they are reported as uncertain.
+const DefaultRuleConfidence = 0.5
+
+type compiledRule struct {
+	pattern  *regexp.Regexp
+	category string
+}
+
+// RuleClassifier labels messages locally by the first matching regexp, without calling the model service.
+type RuleClassifier struct {
+	rules           []compiledRule
+	defaultCategory string
+	confidence      float64
+}
+
+// NewRuleClassifier labels every message with the given confidence, zero means DefaultRuleConfidence.
+func NewRuleClassifier(rules []Rule, defaultCategory string, confidence float64) (*RuleClassifier, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile rule %q: %w", rule.Pattern, err)
+		}
+		compiled = append(compiled, compiledRule{pattern: pattern, category: rule.Category})
+	}
+
+	if defaultCategory == "" {
+		defaultCategory = model.CategoryOffTopic
+	}
+	if confidence == 0 {
+		confidence = DefaultRuleConfidence
+	}
+
+	return &RuleClassifier{
+		rules:           compiled,
+		defaultCategory: defaultCategory,
+		confidence:      confidence,
+	}, nil
+}
+
+func (c *RuleClassifier) Classify(ctx context.Context, messages []model.MessageRequest) ([]model.ClassifiedMessage, error) {
+	classified := make([]model.ClassifiedMessage, 0, len(messages))
+	for _, msg := range messages {
+		category := c.category(msg.Text)
+		confidence := c.confidence
+		classified = append(classified, model.ClassifiedMessage{
+			MessageID:  msg.MessageID,
+			Text:       msg.Text,
+			Label:      model.LabelForCategory(category),
+			Category:   category,
+			Confidence: &confidence,
+			ChatID:     msg.ChatID,
+		})
+	}
+	return classified, nil
+}
+
+func (c *RuleClassifier) category(text string) string {
+	for _, rule := range c.rules {
+		if rule.pattern.MatchString(text) {
+			return rule.category
+		}
+	}
+	return c.defaultCategory
+}
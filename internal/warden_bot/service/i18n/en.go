@@ -0,0 +1,148 @@
+package i18n
+
+var en = catalog{
+	name:       "English",
+	dateLayout: "Jan 2, 2006",
+	months:     [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	weekdays:   [7]string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"},
+	messages: map[string]string{
+		"help": "Available commands:\n\n" +
+			"/report [period] [#thread] - create a report (without a period the date is chosen in a calendar, a #thread from a report limits it to the thread)\n" +
+			"Period: week, month, YYYY-MM-DD or YYYY-MM-DD..YYYY-MM-DD\n" +
+			"/export [json|messages|users] [period] - download the report data as a file\n" +
+			"/userreport @username [period] - report on a user across your chats (week by default)\n" +
+			"/subscribe [daily|weekly] [HH:MM] - receive reports on schedule\n" +
+			"/unsubscribe - cancel a subscription\n" +
+			"/settings - report settings of a chat\n" +
+			"/language [ru|en] - bot language\n" +
+			"/help - help\n" +
+			"Contact: @nit3bo1",
+
+		"dialog.use_buttons":       "Please choose an option with the buttons under the message.",
+		"callback.expired":         "This button has expired. Request the report again: /report",
+		"error.admin_chats":        "Failed to get the list of chats.",
+		"error.not_admin":          "You are not an administrator of this chat.",
+		"error.no_admin_chats":     "You are not an administrator of any group chat.",
+		"report.select_chat":       "Choose a chat:",
+		"report.select_date":       "Choose a date:",
+		"report.generating":        "Generating the report for %s...",
+		"report.invalid_period":    "Invalid period. Use week, month, YYYY-MM-DD or YYYY-MM-DD..YYYY-MM-DD (%d days at most).",
+		"report.error":             "Failed to generate the report. %s",
+		"report.no_messages":       "There were no messages in the chat during the requested period.",
+		"report.send_failed":       "Failed to send the report. Try a shorter period.",
+		"report.chart_caption":     "Unproductive messages over time. On the right: 🟩 productive, 🟥 unproductive, ⬜ uncertain",
+		"export.error":             "Failed to export the report. %s",
+		"language.select":          "Choose a language:",
+		"language.changed":         "Language changed: %s",
+		"language.unknown":         "Unknown language. Available: %s",
+		"language.save_failed":     "Failed to save the language. Please try again.",
+		"frequency.daily":          "daily",
+		"frequency.weekly":         "weekly on Mondays",
+		"subscribe.usage":          "Invalid parameters. Use: /subscribe [daily|weekly] [HH:MM]",
+		"subscribe.select_chat":    "Choose a chat to subscribe to:",
+		"subscribe.error":          "Failed to create the subscription.",
+		"subscribe.done":           "Subscribed: reports will arrive %s at %s (%s).",
+		"unsubscribe.error_list":   "Failed to get the list of subscriptions.",
+		"unsubscribe.none":         "You have no subscriptions.",
+		"unsubscribe.item":         "%s (%s at %s)",
+		"unsubscribe.select":       "Choose a subscription to cancel:",
+		"unsubscribe.error":        "Failed to cancel the subscription.",
+		"unsubscribe.done":         "Subscription cancelled.",
+		"settings.select_chat":     "Choose a chat to configure:",
+		"settings.error_get":       "Failed to get the settings.",
+		"settings.error_save":      "Failed to save the settings.",
+		"settings.invalid":         "Failed to change the setting: %s\n\n%s",
+		"settings.saved":           "Saved.\n\n%s",
+		"settings.threshold":       "the threshold must be a number from 0 to 100",
+		"settings.threshold_order": "the high productivity threshold (%g) is above the low productivity one (%g)",
+		"settings.limit":           "the number must be from 1 to %d",
+		"settings.label_length":    "the label is longer than %d characters",
+		"settings.label_level":     "specify high, normal or low",
+		"settings.unknown":         "unknown setting %q",
+		"settings.timezone":        "unknown timezone %q, use a name such as Europe/Moscow",
+		"settings.help": "To change a setting, send a message:\n" +
+			"high 20 - high productivity when less than 20% of messages are unproductive\n" +
+			"low 50 - low productivity when more than 50% of messages are unproductive\n" +
+			"samples 10 - number of samples in the report\n" +
+			"top 10 - number of users in the report\n" +
+			"label high|normal|low <text> - indicator label, no text restores the default\n" +
+			"timezone Europe/Moscow - chat timezone for day boundaries and schedules, no name restores UTC\n" +
+			"reset - restore the default settings",
+		"settings.text": "Settings of chat %s:\n" +
+			"High productivity: less than %g%% unproductive (%s)\n" +
+			"Low productivity: more than %g%% unproductive (%s)\n" +
+			"Normal: %s\n" +
+			"Samples in the report: %d\n" +
+			"Users in the report: %d\n" +
+			"Timezone: %s",
+
+		"report.text": "📊 <b>Chat report</b>: %s for %s\n\n" +
+			"📋 <b>Summary:</b>\n" +
+			"Total messages: %d\n" +
+			"Productive messages: %d\n" +
+			"Unproductive messages: %d\n" +
+			"Not classified yet: %d\n" +
+			"Low model confidence: %d\n" +
+			"Unproductive messages: %.2f%%\n\n" +
+			"🗂 <b>Categories:</b>\n%s\n\n" +
+			"📎 <b>Message types:</b>\n%s\n\n" +
+			"🧵 <b>Threads and topics:</b>\n%s\n\n" +
+			"🚫 <b>Unproductive message samples:</b>\n%s\n\n" +
+			"👥 <b>Users with the most unproductive messages:</b>\n%s\n\n" +
+			"📈 <b>Unproductive activity over time:</b>\n%s\n\n" +
+			"📉 <b>Trends:</b>\n%s\n\n" +
+			"📌 <b>Productivity</b>: %s",
+		"user_report.usage":     "Specify a user: /userreport @username [period]",
+		"user_report.not_found": "User @%s is not found. They need to send at least one message in a group with the bot.",
+		"user_report.chat":      "- %s: %d messages, %d unproductive",
+		"user_report.text": "👤 <b>User report</b>: %s for %s\n\n" +
+			"📋 <b>Summary:</b>\n" +
+			"Total messages: %d\n" +
+			"Productive messages: %d\n" +
+			"Unproductive messages: %d\n" +
+			"Not classified yet: %d\n" +
+			"Low model confidence: %d\n" +
+			"Productive share: %.2f%%\n\n" +
+			"💬 <b>Chats:</b>\n%s\n" +
+			"🕒 <b>Activity by hour:</b>\n%s\n" +
+			"🚫 <b>Unproductive message samples:</b>\n%s",
+		"report.no_samples":         "No samples.",
+		"report.more_samples":       "and more...",
+		"report.no_categories":      "No classified messages.",
+		"report.category":           "- %s: %d messages",
+		"report.category_uncertain": " (+%d uncertain)",
+		"report.forwarded":          "Forwarded messages: %d",
+		"report.thread_title":       " (thread #%d)",
+		"report.thread":             "- %s: %d messages, %d unproductive",
+		"report.outside_threads":    "Outside of threads",
+		"report.no_threads":         "No replies or topics.",
+		"report.more_threads":       "and %d more threads...",
+		"report.invalid_thread":     "Specify a thread by its number from the report: #123",
+		"report.no_users":           "No users with unproductive messages.",
+		"report.count":              "- %s: %d messages",
+		"report.no_timeline":        "No activity data.",
+		"report.no_trends":          "No data for previous periods.",
+		"report.trend_previous":     "Previous period",
+		"report.trend_baseline":     "%d-day average",
+		"report.trend":              "- %s (%s): %.2f%% unproductive %s, %.1f messages a day %s",
+		"report.points":             "%+.2f pp",
+		"indicator.high":            "High productivity",
+		"indicator.normal":          "Normal",
+		"indicator.low":             "Low productivity",
+		"content.text":              "Text",
+		"content.photo":             "Photos",
+		"content.video":             "Videos",
+		"content.animation":         "GIFs",
+		"content.document":          "Files",
+		"content.sticker":           "Stickers",
+		"content.voice":             "Voice messages",
+		"content.video_note":        "Video messages",
+		"content.audio":             "Audio",
+		"content.other":             "Other",
+		"category.work":             "Work",
+		"category.question":         "Questions",
+		"category.off_topic":        "Off-topic",
+		"category.spam":             "Spam",
+		"category.toxic":            "Toxicity",
+	},
+}
@@ -0,0 +1,94 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	LocaleRu = "ru"
+	LocaleEn = "en"
+	// DefaultLocale is used when the language of the user is unknown
+	DefaultLocale = LocaleRu
+	// FallbackLocale is used for languages without a catalog
+	FallbackLocale = LocaleEn
+)
+
+// Locales lists the supported locales in the order they are offered to the user.
+var Locales = []string{LocaleRu, LocaleEn}
+
+type catalog struct {
+	// name is the language name in the language itself
+	name       string
+	dateLayout string
+	months     [12]string
+	// weekdays start on Monday
+	weekdays [7]string
+	messages map[string]string
+}
+
+var catalogs = map[string]*catalog{
+	LocaleRu: &ru,
+	LocaleEn: &en,
+}
+
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Resolve picks the locale for a Telegram language code such as "en-US".
+func Resolve(languageCode string) string {
+	if languageCode == "" {
+		return DefaultLocale
+	}
+	language, _, _ := strings.Cut(strings.ToLower(languageCode), "-")
+	if IsSupported(language) {
+		return language
+	}
+	return FallbackLocale
+}
+
+func get(locale string) *catalog {
+	if c, ok := catalogs[locale]; ok {
+		return c
+	}
+	return catalogs[DefaultLocale]
+}
+
+// T formats the message of the locale. Missing messages fall back to the default locale and then to the key itself.
+func T(locale, key string, args ...any) string {
+	message, ok := get(locale).messages[key]
+	if !ok {
+		message, ok = catalogs[DefaultLocale].messages[key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+func LanguageName(locale string) string {
+	return get(locale).name
+}
+
+func FormatDate(locale string, t time.Time) string {
+	return t.Format(get(locale).dateLayout)
+}
+
+func FormatDateTime(locale string, t time.Time) string {
+	return t.Format(get(locale).dateLayout + " 15:04")
+}
+
+func MonthName(locale string, month time.Month) string {
+	return get(locale).months[month-1]
+}
+
+// Weekdays returns the short weekday names starting on Monday.
+func Weekdays(locale string) [7]string {
+	return get(locale).weekdays
+}
@@ -0,0 +1,32 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogs(t *testing.T) {
+	for locale, c := range catalogs {
+		for _, other := range catalogs {
+			for key := range other.messages {
+				assert.Contains(t, c.messages, key, "%s catalog misses %s", locale, key)
+			}
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert.Equal(t, LocaleRu, Resolve(""))
+	assert.Equal(t, LocaleRu, Resolve("ru"))
+	assert.Equal(t, LocaleEn, Resolve("en-US"))
+	assert.Equal(t, LocaleEn, Resolve("de"))
+}
+
+func TestT(t *testing.T) {
+	assert.Equal(t, "Language changed: English", T(LocaleEn, "language.changed", "English"))
+	assert.Equal(t, "Выберите язык:", T("fr", "language.select"))
+	assert.Equal(t, "missing.key", T(LocaleEn, "missing.key"))
+	assert.Equal(t, "Dec 1, 2024", FormatDate(LocaleEn, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)))
+}
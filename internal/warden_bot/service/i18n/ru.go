@@ -0,0 +1,148 @@
+package i18n
+
+var ru = catalog{
+	name:       "Русский",
+	dateLayout: "02.01.2006",
+	months:     [12]string{"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь", "Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь"},
+	weekdays:   [7]string{"Пн", "Вт", "Ср", "Чт", "Пт", "Сб", "Вс"},
+	messages: map[string]string{
+		"help": "Доступные команды:\n\n" +
+			"/report [период] [#ветка] - создать отчет (без периода дата выбирается в календаре, #ветка из отчета ограничивает его одной веткой)\n" +
+			"Период: week, month, YYYY-MM-DD или YYYY-MM-DD..YYYY-MM-DD\n" +
+			"/export [json|messages|users] [период] - выгрузить данные отчета файлом\n" +
+			"/userreport @username [период] - отчет по пользователю во всех ваших чатах (по умолчанию week)\n" +
+			"/subscribe [daily|weekly] [HH:MM] - получать отчеты по расписанию\n" +
+			"/unsubscribe - отменить подписку\n" +
+			"/settings - настройки отчетов чата\n" +
+			"/language [ru|en] - язык бота\n" +
+			"/help - помощь\n" +
+			"Contact: @nit3bo1",
+
+		"dialog.use_buttons":       "Выберите вариант с помощью кнопок под сообщением.",
+		"callback.expired":         "Кнопка устарела. Запросите отчет заново: /report",
+		"error.admin_chats":        "Произошла ошибка при получении списка чатов.",
+		"error.not_admin":          "Вы не являетесь администратором этого чата.",
+		"error.no_admin_chats":     "Вы не являетесь администратором ни в одном групповом чате.",
+		"report.select_chat":       "Выберите чат:",
+		"report.select_date":       "Выберите дату:",
+		"report.generating":        "Формирую отчет за %s...",
+		"report.invalid_period":    "Некорректный период. Используйте week, month, YYYY-MM-DD или YYYY-MM-DD..YYYY-MM-DD (не длиннее %d дней).",
+		"report.error":             "Произошла ошибка при генерации отчета. %s",
+		"report.no_messages":       "В чате не было сообщений за запрашиваемый период.",
+		"report.send_failed":       "Не удалось отправить отчет. Попробуйте выбрать период короче.",
+		"report.chart_caption":     "Непродуктивные сообщения по времени. Справа: 🟩 продуктивные, 🟥 непродуктивные, ⬜ под вопросом",
+		"export.error":             "Произошла ошибка при выгрузке отчета. %s",
+		"language.select":          "Выберите язык:",
+		"language.changed":         "Язык изменен: %s",
+		"language.unknown":         "Неизвестный язык. Доступны: %s",
+		"language.save_failed":     "Не удалось сохранить язык. Попробуйте еще раз.",
+		"frequency.daily":          "ежедневно",
+		"frequency.weekly":         "еженедельно по понедельникам",
+		"subscribe.usage":          "Некорректные параметры. Используйте: /subscribe [daily|weekly] [HH:MM]",
+		"subscribe.select_chat":    "Выберите чат для подписки:",
+		"subscribe.error":          "Произошла ошибка при оформлении подписки.",
+		"subscribe.done":           "Подписка оформлена: отчеты будут приходить %s в %s (%s).",
+		"unsubscribe.error_list":   "Произошла ошибка при получении списка подписок.",
+		"unsubscribe.none":         "У вас нет подписок.",
+		"unsubscribe.item":         "%s (%s в %s)",
+		"unsubscribe.select":       "Выберите подписку для отмены:",
+		"unsubscribe.error":        "Произошла ошибка при отмене подписки.",
+		"unsubscribe.done":         "Подписка отменена.",
+		"settings.select_chat":     "Выберите чат для настройки:",
+		"settings.error_get":       "Произошла ошибка при получении настроек.",
+		"settings.error_save":      "Произошла ошибка при сохранении настроек.",
+		"settings.invalid":         "Не удалось изменить настройку: %s\n\n%s",
+		"settings.saved":           "Сохранено.\n\n%s",
+		"settings.threshold":       "порог должен быть числом от 0 до 100",
+		"settings.threshold_order": "порог высокой продуктивности (%g) больше порога низкой (%g)",
+		"settings.limit":           "количество должно быть от 1 до %d",
+		"settings.label_length":    "подпись длиннее %d символов",
+		"settings.label_level":     "укажите high, normal или low",
+		"settings.unknown":         "неизвестная настройка %q",
+		"settings.timezone":        "неизвестный часовой пояс %q, используйте название вида Europe/Moscow",
+		"settings.help": "Чтобы изменить настройку, отправьте сообщение:\n" +
+			"high 20 - высокая продуктивность, если непродуктивных меньше 20%\n" +
+			"low 50 - низкая продуктивность, если непродуктивных больше 50%\n" +
+			"samples 10 - количество примеров в отчете\n" +
+			"top 10 - количество пользователей в отчете\n" +
+			"label high|normal|low <текст> - подпись индикатора, без текста - стандартная\n" +
+			"timezone Europe/Moscow - часовой пояс чата для границ дней и расписания, без названия - UTC\n" +
+			"reset - вернуть настройки по умолчанию",
+		"settings.text": "Настройки чата %s:\n" +
+			"Высокая продуктивность: меньше %g%% непродуктивных (%s)\n" +
+			"Низкая продуктивность: больше %g%% непродуктивных (%s)\n" +
+			"Нормально: %s\n" +
+			"Примеров в отчете: %d\n" +
+			"Пользователей в отчете: %d\n" +
+			"Часовой пояс: %s",
+
+		"report.text": "📊 <b>Отчет по чату</b>: %s за %s\n\n" +
+			"📋 <b>Общая статистика:</b>\n" +
+			"Всего сообщений: %d\n" +
+			"Продуктивных сообщений: %d\n" +
+			"Непродуктивных сообщений: %d\n" +
+			"Еще не классифицировано: %d\n" +
+			"С низкой уверенностью модели: %d\n" +
+			"Процент непродуктивных сообщений: %.2f%%\n\n" +
+			"🗂 <b>Категории:</b>\n%s\n\n" +
+			"📎 <b>Типы сообщений:</b>\n%s\n\n" +
+			"🧵 <b>Ветки и темы:</b>\n%s\n\n" +
+			"🚫 <b>Примеры непродуктивных сообщений:</b>\n%s\n\n" +
+			"👥 <b>Пользователи с наибольшим количеством непродуктивных сообщений:</b>\n%s\n\n" +
+			"📈 <b>Активность непродуктивных сообщений по времени:</b>\n%s\n\n" +
+			"📉 <b>Динамика:</b>\n%s\n\n" +
+			"📌 <b>Индикатор продуктивности</b>: %s",
+		"user_report.usage":     "Укажите пользователя: /userreport @username [период]",
+		"user_report.not_found": "Пользователь @%s не найден. Он должен написать хотя бы одно сообщение в группе с ботом.",
+		"user_report.chat":      "- %s: %d сообщений, непродуктивных %d",
+		"user_report.text": "👤 <b>Отчет по пользователю</b>: %s за %s\n\n" +
+			"📋 <b>Общая статистика:</b>\n" +
+			"Всего сообщений: %d\n" +
+			"Продуктивных сообщений: %d\n" +
+			"Непродуктивных сообщений: %d\n" +
+			"Еще не классифицировано: %d\n" +
+			"С низкой уверенностью модели: %d\n" +
+			"Доля продуктивных: %.2f%%\n\n" +
+			"💬 <b>Чаты:</b>\n%s\n" +
+			"🕒 <b>Активность по часам:</b>\n%s\n" +
+			"🚫 <b>Примеры непродуктивных сообщений:</b>\n%s",
+		"report.no_samples":         "Нет примеров.",
+		"report.more_samples":       "и другие...",
+		"report.no_categories":      "Нет классифицированных сообщений.",
+		"report.category":           "- %s: %d сообщений",
+		"report.category_uncertain": " (+%d под вопросом)",
+		"report.forwarded":          "Пересланных сообщений: %d",
+		"report.thread_title":       " (ветка #%d)",
+		"report.thread":             "- %s: %d сообщений, непродуктивных %d",
+		"report.outside_threads":    "Вне веток",
+		"report.no_threads":         "Нет ответов и тем.",
+		"report.more_threads":       "и еще %d веток...",
+		"report.invalid_thread":     "Ветка указывается номером из отчета: #123",
+		"report.no_users":           "Нет пользователей с непродуктивными сообщениями.",
+		"report.count":              "- %s: %d сообщений",
+		"report.no_timeline":        "Нет данных о временной активности.",
+		"report.no_trends":          "Нет данных за прошлые периоды.",
+		"report.trend_previous":     "Предыдущий период",
+		"report.trend_baseline":     "Среднее за %d дней",
+		"report.trend":              "- %s (%s): непродуктивных %.2f%% %s, сообщений в день %.1f %s",
+		"report.points":             "%+.2f п.п.",
+		"indicator.high":            "Высокая продуктивность",
+		"indicator.normal":          "Нормально",
+		"indicator.low":             "Низкая продуктивность",
+		"content.text":              "Текст",
+		"content.photo":             "Фото",
+		"content.video":             "Видео",
+		"content.animation":         "GIF",
+		"content.document":          "Файлы",
+		"content.sticker":           "Стикеры",
+		"content.voice":             "Голосовые",
+		"content.video_note":        "Видеосообщения",
+		"content.audio":             "Аудио",
+		"content.other":             "Другое",
+		"category.work":             "Работа",
+		"category.question":         "Вопросы",
+		"category.off_topic":        "Оффтоп",
+		"category.spam":             "Спам",
+		"category.toxic":            "Токсичность",
+	},
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	callbackChat  = "chat"  // chatID
+	callbackMonth = "month" // chatID, YYYY-MM
+	callbackDay   = "day"   // chatID, YYYY-MM-DD
+	// callbackSubscribe and callbackUnsubscribe manage report subscriptions
+	callbackSubscribe   = "sub"   // chatID, frequency, HHMM
+	callbackUnsubscribe = "unsub" // chatID
+	callbackSettings    = "set"   // chatID
+	// callbackLanguage is the only action without a chat
+	callbackLanguage = "lang" // locale
+	// callbackNoop is sent by decorative calendar cells and is not signed
+	callbackNoop = "noop"
+
+	monthLayout = "2006-01"
+)
+
+// chatsKeyboard signs the chat ID followed by args into the data of every button.
+func (s *WardenBotService) chatsKeyboard(userID int, chats []model.Chat, action string, args ...string) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(chats))
+	for _, chat := range chats {
+		data := s.signer.Sign(userID, action, append([]string{strconv.FormatInt(chat.ChatID, 10)}, args...)...)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(chat.Title, data)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// calendarKeyboard builds a Monday-first month grid. Days after today and the months after the current one are not selectable.
+func (s *WardenBotService) calendarKeyboard(userID int, chatID int64, month time.Time, today time.Time, locale string) tgbotapi.InlineKeyboardMarkup {
+	chat := strconv.FormatInt(chatID, 10)
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	noop := func(text string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(text, callbackNoop)
+	}
+
+	prev := month.AddDate(0, -1, 0)
+	next := month.AddDate(0, 1, 0)
+	nextButton := noop(" ")
+	if !next.After(today) {
+		nextButton = tgbotapi.NewInlineKeyboardButtonData("»", s.signer.Sign(userID, callbackMonth, chat, next.Format(monthLayout)))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("«", s.signer.Sign(userID, callbackMonth, chat, prev.Format(monthLayout))),
+			noop(fmt.Sprintf("%s %d", i18n.MonthName(locale, month.Month()), month.Year())),
+			nextButton,
+		),
+	}
+
+	weekdays := i18n.Weekdays(locale)
+	header := make([]tgbotapi.InlineKeyboardButton, 0, len(weekdays))
+	for _, name := range weekdays {
+		header = append(header, noop(name))
+	}
+	rows = append(rows, header)
+
+	week := make([]tgbotapi.InlineKeyboardButton, 0, 7)
+	for i := 0; i < (int(month.Weekday())+6)%7; i++ {
+		week = append(week, noop(" "))
+	}
+	for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+		if day.After(today) {
+			week = append(week, noop(strconv.Itoa(day.Day())))
+		} else {
+			week = append(week, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(day.Day()), s.signer.Sign(userID, callbackDay, chat, day.Format(time.DateOnly))))
+		}
+
+		if len(week) == 7 {
+			rows = append(rows, week)
+			week = make([]tgbotapi.InlineKeyboardButton, 0, 7)
+		}
+	}
+	if len(week) > 0 {
+		for len(week) < 7 {
+			week = append(week, noop(" "))
+		}
+		rows = append(rows, week)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (s *WardenBotService) languageKeyboard(userID int) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(i18n.Locales))
+	for _, locale := range i18n.Locales {
+		data := s.signer.Sign(userID, callbackLanguage, locale)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(i18n.LanguageName(locale), data)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
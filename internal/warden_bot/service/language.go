@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// userLocale returns the language chosen with /language, otherwise the one of the Telegram client.
+func (s *WardenBotService) userLocale(ctx context.Context, user *tgbotapi.User) string {
+	if user == nil {
+		return i18n.DefaultLocale
+	}
+	locale, err := s.storage.GetUserLocale(ctx, user.ID)
+	if err != nil {
+		log.Printf("Failed to get locale of user %d: %v", user.ID, err)
+	}
+	if i18n.IsSupported(locale) {
+		return locale
+	}
+	return i18n.Resolve(user.LanguageCode)
+}
+
+// processLanguageCommand changes the language right away when it is given, otherwise offers the supported ones.
+func (s *WardenBotService) processLanguageCommand(ctx context.Context, message *tgbotapi.Message, userID int, locale string) {
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "language.select"))
+		msg.ReplyMarkup = s.languageKeyboard(userID)
+		s.tgBot.Send(msg)
+		return
+	}
+
+	if !i18n.IsSupported(arg) {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "language.unknown", strings.Join(i18n.Locales, ", "))))
+		return
+	}
+
+	s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, s.saveLanguage(ctx, userID, locale, arg)))
+}
+
+func (s *WardenBotService) setLanguage(ctx context.Context, privateChatID int64, messageID int, userID int, currentLocale, locale string) {
+	if !i18n.IsSupported(locale) {
+		log.Printf("Unknown locale %q in callback data", locale)
+		return
+	}
+	s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, s.saveLanguage(ctx, userID, currentLocale, locale)))
+}
+
+// saveLanguage returns the confirmation in the new language, or the failure in the current one.
+func (s *WardenBotService) saveLanguage(ctx context.Context, userID int, currentLocale, locale string) string {
+	if err := s.storage.SaveUserLocale(ctx, userID, locale); err != nil {
+		log.Printf("Failed to save locale of user %d: %v", userID, err)
+		return i18n.T(currentLocale, "language.save_failed")
+	}
+	return i18n.T(locale, "language.changed", i18n.LanguageName(locale))
+}
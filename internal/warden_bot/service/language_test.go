@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLanguage(t *testing.T) {
+	ctx := context.Background()
+	userID := 7
+
+	t.Run("Telegram language is used by default", func(t *testing.T) {
+		_, _, wardenBotService := setupTest()
+		assert.Equal(t, i18n.LocaleEn, wardenBotService.userLocale(ctx, &tgbotapi.User{ID: userID, LanguageCode: "en-GB"}))
+	})
+
+	t.Run("Language command saves preference", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveUserLocale", ctx, userID, i18n.LocaleEn).Return(nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return c.Text == "Language changed: English"
+		})).Return(tgbotapi.Message{}, nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: &tgbotapi.Message{
+			Text:     "/language en",
+			Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 9}},
+			From:     &tgbotapi.User{ID: userID, LanguageCode: "ru"},
+			Chat:     &tgbotapi.Chat{ID: 7, Type: "private"},
+		}})
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+	})
+
+	t.Run("Language button is handled without chat", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		mockStorage.On("SaveUserLocale", ctx, userID, i18n.LocaleRu).Return(nil)
+		mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.EditMessageTextConfig) bool {
+			return c.Text == "Язык изменен: Русский"
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, &tgbotapi.CallbackQuery{
+			ID:      "1",
+			From:    &tgbotapi.User{ID: userID},
+			Message: &tgbotapi.Message{MessageID: 10, Chat: &tgbotapi.Chat{ID: 7}},
+			Data:    wardenBotService.signer.Sign(userID, callbackLanguage, i18n.LocaleRu),
+		})
+
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+	})
+
+	t.Run("Language is not confirmed when saving fails", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveUserLocale", ctx, userID, i18n.LocaleEn).Return(errors.New("database error"))
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return c.Text == "Не удалось сохранить язык. Попробуйте еще раз."
+		})).Return(tgbotapi.Message{}, nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: &tgbotapi.Message{
+			Text:     "/language en",
+			Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 9}},
+			From:     &tgbotapi.User{ID: userID, LanguageCode: "ru"},
+			Chat:     &tgbotapi.Chat{ID: 7, Type: "private"},
+		}})
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+	})
+}
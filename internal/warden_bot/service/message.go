@@ -0,0 +1,101 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// newMessage converts a group message into a pending message of the author with the given name.
+func newMessage(message *tgbotapi.Message, fullName string) *model.Message {
+	msg := &model.Message{
+		MessageID:    uint64(message.MessageID),
+		UserID:       message.From.ID,
+		UserFullName: fullName,
+		ContentType:  contentType(message),
+		Text:         singleLine(message.Text),
+		Caption:      singleLine(message.Caption),
+		Entities:     entityTypes(message),
+		Date:         time.Unix(int64(message.Date), 0).UTC(),
+		Status:       model.MessageStatusPending,
+		ChatID:       message.Chat.ID,
+	}
+	if message.ReplyToMessage != nil {
+		msg.ReplyToMessageID = uint64(message.ReplyToMessage.MessageID)
+	}
+	if message.ForwardFrom != nil {
+		msg.ForwardFromUserID = message.ForwardFrom.ID
+	}
+	if message.ForwardFromChat != nil {
+		msg.ForwardFromChatID = message.ForwardFromChat.ID
+	}
+	return msg
+}
+
+// resolveThread puts a reply into the thread of the replied message, or starts a thread at the replied message.
+// The Bot API version of the client does not deliver message_thread_id, but messages of a forum topic reply
+// to the message that created the topic, so topics are resolved the same way.
+func (s *WardenBotService) resolveThread(ctx context.Context, msg *model.Message) error {
+	if msg.ReplyToMessageID == 0 {
+		return nil
+	}
+	threadID, err := s.storage.GetMessageThreadID(ctx, msg.ChatID, msg.ReplyToMessageID)
+	if err != nil {
+		return err
+	}
+	msg.ThreadID = cmp.Or(threadID, msg.ReplyToMessageID)
+	return nil
+}
+
+// contentType returns the type of the media of the message. Messages with neither text nor known media,
+// e.g. locations and contacts, are ContentTypeOther.
+func contentType(message *tgbotapi.Message) string {
+	switch {
+	// Animations come with a document, so they are checked first
+	case message.Animation != nil:
+		return model.ContentTypeAnimation
+	case message.Photo != nil:
+		return model.ContentTypePhoto
+	case message.Video != nil:
+		return model.ContentTypeVideo
+	case message.Document != nil:
+		return model.ContentTypeDocument
+	case message.Sticker != nil:
+		return model.ContentTypeSticker
+	case message.Voice != nil:
+		return model.ContentTypeVoice
+	case message.VideoNote != nil:
+		return model.ContentTypeVideoNote
+	case message.Audio != nil:
+		return model.ContentTypeAudio
+	case message.Text != "":
+		return model.ContentTypeText
+	default:
+		return model.ContentTypeOther
+	}
+}
+
+// entityTypes lists the distinct entity types of the message in order of appearance. The Bot API version
+// of the client does not deliver caption entities, so only the entities of the text are known.
+func entityTypes(message *tgbotapi.Message) string {
+	if message.Entities == nil {
+		return ""
+	}
+	types := []string{}
+	for _, entity := range *message.Entities {
+		if !slices.Contains(types, entity.Type) {
+			types = append(types, entity.Type)
+		}
+	}
+	return strings.Join(types, ",")
+}
+
+// singleLine keeps stored texts on one line for reports and exports.
+func singleLine(text string) string {
+	return strings.ReplaceAll(text, "\n", " ")
+}
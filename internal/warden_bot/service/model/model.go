@@ -1,36 +1,262 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
+const (
+	// MessageStatusPending marks messages the classifier has not labelled yet, their Label is meaningless
+	MessageStatusPending    = "pending"
+	MessageStatusClassified = "classified"
+)
+
+const (
+	CategoryWork     = "work"
+	CategoryQuestion = "question"
+	CategoryOffTopic = "off_topic"
+	CategorySpam     = "spam"
+	CategoryToxic    = "toxic"
+)
+
+// Categories lists all known categories in display order.
+var Categories = []string{CategoryWork, CategoryQuestion, CategoryOffTopic, CategorySpam, CategoryToxic}
+
+// LabelForCategory returns the binary label kept for compatibility: 1 - productive, 0 - unproductive.
+func LabelForCategory(category string) uint {
+	switch category {
+	case CategoryWork, CategoryQuestion:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// CategoryForLabel maps a binary label of a model without categories onto a category.
+func CategoryForLabel(label uint) string {
+	if label == 1 {
+		return CategoryWork
+	}
+	return CategoryOffTopic
+}
+
+// Content types of messages, media without a known type are stored as ContentTypeOther
+const (
+	ContentTypeText      = "text"
+	ContentTypePhoto     = "photo"
+	ContentTypeVideo     = "video"
+	ContentTypeAnimation = "animation"
+	ContentTypeDocument  = "document"
+	ContentTypeSticker   = "sticker"
+	ContentTypeVoice     = "voice"
+	ContentTypeVideoNote = "video_note"
+	ContentTypeAudio     = "audio"
+	ContentTypeOther     = "other"
+)
+
+// ContentTypes lists all content types in display order.
+var ContentTypes = []string{
+	ContentTypeText, ContentTypePhoto, ContentTypeVideo, ContentTypeAnimation, ContentTypeDocument,
+	ContentTypeSticker, ContentTypeVoice, ContentTypeVideoNote, ContentTypeAudio, ContentTypeOther,
+}
+
+// Message is a group chat message, Date is stored in UTC. UserFullName is the name of the author when the message
+// was sent, UserID is 0 for messages saved before user IDs were stored.
+// ReplyToMessageID, ForwardFromUserID and ForwardFromChatID are 0 when the message is not a reply or a forward,
+// Entities is the comma-separated list of the entity types of the text or the caption, e.g. "mention,url".
+// ThreadID is the first message of the reply thread or the forum topic, 0 for messages outside of threads.
 type Message struct {
-	MessageID    uint64    `json:"messageId"`
-	UserFullName string    `json:"userName"`
-	Text         string    `json:"text"`
-	Date         time.Time `json:"date"`
-	Label        uint      `json:"label"`
-	ChatID       uint64    `json:"chatId"`
-	Chat         Chat      `json:"chat" gorm:"foreignKey:ChatID;references:ChatID"`
+	MessageID         uint64    `json:"messageId"`
+	UserID            int       `json:"userId"`
+	UserFullName      string    `json:"userName"`
+	ContentType       string    `json:"contentType"`
+	Text              string    `json:"text"`
+	Caption           string    `json:"caption"`
+	Entities          string    `json:"entities"`
+	ReplyToMessageID  uint64    `json:"replyToMessageId"`
+	ForwardFromUserID int       `json:"forwardFromUserId"`
+	ForwardFromChatID int64     `json:"forwardFromChatId"`
+	ThreadID          uint64    `json:"threadId"`
+	Date              time.Time `json:"date"`
+	Label             uint      `json:"label"`
+	Category          string    `json:"category"`
+	Confidence        float64   `json:"confidence"`
+	Status            string    `json:"status"`
+	ChatID            int64     `json:"chatId"`
+	Chat              Chat      `json:"chat" gorm:"foreignKey:ChatID;references:ChatID"`
 }
 
 func (m *Message) TableName() string {
 	return "messages"
 }
 
+// Content is the text of the message or the caption of its media, it is what the classifier sees.
+func (m *Message) Content() string {
+	if m.Text != "" {
+		return m.Text
+	}
+	return m.Caption
+}
+
+// IsForwarded tells whether the message is a forward from a user or a chat.
+func (m *Message) IsForwarded() bool {
+	return m.ForwardFromUserID != 0 || m.ForwardFromChatID != 0
+}
+
+// MessageRevision keeps the text and the caption a message had before an edit, the current ones stay in Message.
+type MessageRevision struct {
+	ID        uint64    `json:"id" gorm:"primaryKey;autoIncrement"`
+	MessageID uint64    `json:"messageId"`
+	ChatID    int64     `json:"chatId"`
+	Text      string    `json:"text"`
+	Caption   string    `json:"caption"`
+	EditedAt  time.Time `json:"editedAt"`
+}
+
+func (r *MessageRevision) TableName() string {
+	return "message_revisions"
+}
+
+// Chat is inactive once the bot is removed from it or it migrates, MigratedToChatID is then the chat that continues it.
 type Chat struct {
-	ChatID   uint64    `json:"chatId" gorm:"primaryKey;autoIncrement"`
-	Type     string    `json:"type" gorm:"type:varchar(50)"`
-	Title    string    `json:"title" gorm:"type:varchar(255)"`
-	Messages []Message `json:"messages" gorm:"foreignKey:ChatID;references:ChatID"`
+	ChatID           int64     `json:"chatId" gorm:"primaryKey;autoIncrement"`
+	Type             string    `json:"type" gorm:"type:varchar(50)"`
+	Title            string    `json:"title" gorm:"type:varchar(255)"`
+	Active           bool      `json:"active" gorm:"default:true"`
+	MigratedToChatID int64     `json:"migratedToChatId"`
+	Messages         []Message `json:"messages" gorm:"foreignKey:ChatID;references:ChatID"`
 }
 
 func (ch *Chat) TableName() string {
 	return "chats"
 }
 
+// User is the latest known profile of a message author.
+type User struct {
+	UserID    int       `json:"userId" gorm:"primaryKey"`
+	Username  string    `json:"username"`
+	FullName  string    `json:"fullName"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (u *User) TableName() string {
+	return "users"
+}
+
+// DisplayName is the full name followed by the username when there is one.
+func (u *User) DisplayName() string {
+	if u.Username == "" {
+		return u.FullName
+	}
+	return fmt.Sprintf("%s (@%s)", u.FullName, u.Username)
+}
+
+type UpdateOffset struct {
+	ID       int `json:"id" gorm:"primaryKey"`
+	UpdateID int `json:"updateId"`
+}
+
+func (o *UpdateOffset) TableName() string {
+	return "update_offsets"
+}
+
+// ClassificationWatermark is the last message of a chat up to which everything has been classified.
+// Messages are ordered by (ClassifiedUntil, MessageID), since several messages may share a second.
+type ClassificationWatermark struct {
+	ChatID          int64     `json:"chatId" gorm:"primaryKey"`
+	ClassifiedUntil time.Time `json:"classifiedUntil"`
+	MessageID       uint64    `json:"messageId"`
+}
+
+func (w *ClassificationWatermark) TableName() string {
+	return "classification_watermarks"
+}
+
+// Report defaults of chats without their own settings
+const (
+	DefaultHighProductivityBelow = 20
+	DefaultLowProductivityAbove  = 50
+	DefaultSampleLimit           = 10
+	DefaultTopUsersLimit         = 10
+)
+
+// ChatSettings tunes the reports of a chat. Empty labels fall back to the built-in ones.
+type ChatSettings struct {
+	ChatID int64 `json:"chatId" gorm:"primaryKey"`
+	// HighProductivityBelow and LowProductivityAbove are the unproductive percentages of the productivity indicator
+	HighProductivityBelow float64 `json:"highProductivityBelow"`
+	LowProductivityAbove  float64 `json:"lowProductivityAbove"`
+	SampleLimit           int     `json:"sampleLimit"`
+	TopUsersLimit         int     `json:"topUsersLimit"`
+	HighLabel             string  `json:"highLabel"`
+	NormalLabel           string  `json:"normalLabel"`
+	LowLabel              string  `json:"lowLabel"`
+	// Timezone is an IANA name, empty means UTC
+	Timezone string `json:"timezone"`
+}
+
+func (s *ChatSettings) TableName() string {
+	return "chat_settings"
+}
+
+// Location returns the timezone of the chat, UTC when it is not set or unknown.
+func (s *ChatSettings) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func DefaultChatSettings(chatID int64) *ChatSettings {
+	return &ChatSettings{
+		ChatID:                chatID,
+		HighProductivityBelow: DefaultHighProductivityBelow,
+		LowProductivityAbove:  DefaultLowProductivityAbove,
+		SampleLimit:           DefaultSampleLimit,
+		TopUsersLimit:         DefaultTopUsersLimit,
+	}
+}
+
+const (
+	FrequencyDaily  = "daily"
+	FrequencyWeekly = "weekly"
+)
+
+// Subscription delivers reports of a chat to the private chat of an admin on schedule.
+type Subscription struct {
+	UserID        int    `json:"userId" gorm:"primaryKey"`
+	ChatID        int64  `json:"chatId" gorm:"primaryKey"`
+	PrivateChatID int64  `json:"privateChatId"`
+	Frequency     string `json:"frequency"`
+	// SendAt is the time of day in HH:MM
+	SendAt     string    `json:"sendAt"`
+	LastSentAt time.Time `json:"lastSentAt"`
+	// Locale is the language of the subscriber when subscribing, used unless a preference is saved later
+	Locale string `json:"locale"`
+}
+
+func (s *Subscription) TableName() string {
+	return "subscriptions"
+}
+
+// UserPreferences keeps the settings chosen by a user in the private chat.
+type UserPreferences struct {
+	UserID int    `json:"userId" gorm:"primaryKey"`
+	Locale string `json:"locale"`
+}
+
+func (p *UserPreferences) TableName() string {
+	return "user_preferences"
+}
+
 type MessageRequest struct {
 	MessageID uint64 `json:"message_id"`
 	Text      string `json:"text"`
-	ChatID    uint64 `json:"chat_id"`
+	ChatID    int64  `json:"chat_id"`
 }
 
 type MessagesRequest struct {
@@ -41,7 +267,10 @@ type ClassifiedMessage struct {
 	MessageID uint64 `json:"message_id"`
 	Text      string `json:"text"`
 	Label     uint   `json:"label"`
-	ChatID    uint64 `json:"chat_id"`
+	// Category and Confidence are optional, older model versions only return Label
+	Category   string   `json:"category,omitempty"`
+	Confidence *float64 `json:"confidence,omitempty"`
+	ChatID     int64    `json:"chat_id"`
 }
 
 type ClassifiedMessagesResponse struct {
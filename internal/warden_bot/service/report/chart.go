@@ -0,0 +1,179 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	chartMargin = 40
+	// splitWidth is the width of the productive/unproductive bar on the right
+	splitWidth = 60
+	// maxAxisLabels keeps labels of long timelines from overlapping
+	maxAxisLabels = 12
+	fontScale     = 2
+)
+
+var (
+	backgroundColor   = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	axisColor         = color.RGBA{R: 60, G: 60, B: 60, A: 255}
+	productiveColor   = color.RGBA{R: 76, G: 175, B: 80, A: 255}
+	unproductiveColor = color.RGBA{R: 229, G: 57, B: 53, A: 255}
+	uncertainColor    = color.RGBA{R: 189, G: 189, B: 189, A: 255}
+)
+
+// glyphs is a 3x5 bitmap font with the characters used in axis labels, every row keeps 3 bits.
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'.': {0, 0, 0, 0, 2},
+	':': {0, 2, 0, 2, 0},
+	'%': {5, 1, 2, 4, 5},
+}
+
+// RenderChart draws the activity timeline of unproductive messages as bars and, on the right, the split of
+// the classified messages: productive at the bottom, unproductive above them and uncertain ones on top.
+func RenderChart(r *Report) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: backgroundColor}, image.Point{}, draw.Src)
+
+	plot := image.Rect(chartMargin, chartMargin/2, chartWidth-splitWidth-2*chartMargin, chartHeight-chartMargin)
+	drawTimeline(img, plot, r)
+
+	split := image.Rect(chartWidth-splitWidth-chartMargin, chartMargin/2, chartWidth-chartMargin, chartHeight-chartMargin)
+	drawSplit(img, split, r)
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// timelineBuckets spreads the timeline over every step of the period, including the empty ones.
+func timelineBuckets(r *Report) ([]time.Time, []int) {
+	step := r.TimelineStep
+	if step == 0 {
+		step = time.Hour
+	}
+
+	counts := make(map[time.Time]int, len(r.ActivityTimeline))
+	for _, point := range r.ActivityTimeline {
+		counts[point.Timestamp] = point.Count
+	}
+
+	var timestamps []time.Time
+	var values []int
+	for t := r.Period.From; t.Before(r.Period.To); t = nextStep(t, step) {
+		timestamps = append(timestamps, t)
+		values = append(values, counts[t])
+	}
+	return timestamps, values
+}
+
+func drawTimeline(img *image.RGBA, plot image.Rectangle, r *Report) {
+	timestamps, values := timelineBuckets(r)
+
+	maxValue := 1
+	for _, value := range values {
+		maxValue = max(maxValue, value)
+	}
+
+	fillRect(img, image.Rect(plot.Min.X, plot.Max.Y, plot.Max.X, plot.Max.Y+1), axisColor)
+	fillRect(img, image.Rect(plot.Min.X-1, plot.Min.Y, plot.Min.X, plot.Max.Y), axisColor)
+	drawText(img, plot.Min.X-textWidth(fmt.Sprint(maxValue))-4, plot.Min.Y, fmt.Sprint(maxValue))
+	drawText(img, plot.Min.X-textWidth("0")-4, plot.Max.Y-5*fontScale, "0")
+
+	if len(values) == 0 {
+		return
+	}
+
+	barWidth := max(plot.Dx()/len(values), 1)
+	gap := 0
+	if barWidth > 3 {
+		gap = 1
+	}
+
+	labelEvery := (len(values) + maxAxisLabels - 1) / maxAxisLabels
+	layout := "15"
+	if r.TimelineStep >= 24*time.Hour {
+		layout = "02.01"
+	}
+
+	for i, value := range values {
+		x := plot.Min.X + i*barWidth
+		height := value * plot.Dy() / maxValue
+		fillRect(img, image.Rect(x+gap, plot.Max.Y-height, x+barWidth-gap, plot.Max.Y), unproductiveColor)
+
+		if i%labelEvery == 0 {
+			drawText(img, x, plot.Max.Y+4, timestamps[i].Format(layout))
+		}
+	}
+}
+
+func drawSplit(img *image.RGBA, split image.Rectangle, r *Report) {
+	uncertain := r.LowConfidenceMessages
+	total := r.ProductiveMessages + r.UnproductiveMessages + uncertain
+	fillRect(img, image.Rect(split.Min.X, split.Max.Y, split.Max.X, split.Max.Y+1), axisColor)
+	if total == 0 {
+		return
+	}
+
+	y := split.Max.Y
+	for _, part := range []struct {
+		count int
+		color color.Color
+	}{
+		{r.ProductiveMessages, productiveColor},
+		{r.UnproductiveMessages, unproductiveColor},
+		{uncertain, uncertainColor},
+	} {
+		height := part.count * split.Dy() / total
+		fillRect(img, image.Rect(split.Min.X, y-height, split.Max.X, y), part.color)
+		y -= height
+	}
+
+	label := fmt.Sprintf("%.0f%%", r.UnproductivePercentage)
+	drawText(img, split.Min.X+(split.Dx()-textWidth(label))/2, split.Max.Y+4, label)
+}
+
+func fillRect(img *image.RGBA, rect image.Rectangle, c color.Color) {
+	draw.Draw(img, rect, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+func textWidth(text string) int {
+	return len(text) * 4 * fontScale
+}
+
+// drawText renders text with glyphs, the point is the top left corner. Unknown characters are left blank.
+func drawText(img *image.RGBA, x, y int, text string) {
+	for _, char := range text {
+		glyph := glyphs[char]
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(1<<(2-col)) == 0 {
+					continue
+				}
+				px := x + col*fontScale
+				py := y + row*fontScale
+				fillRect(img, image.Rect(px, py, px+fontScale, py+fontScale), axisColor)
+			}
+		}
+		x += 4 * fontScale
+	}
+}
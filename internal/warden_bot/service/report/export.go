@@ -0,0 +1,181 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+const (
+	// FormatJSON is the Report struct itself
+	FormatJSON = "json"
+	// FormatMessages is a CSV with the classification of every message
+	FormatMessages = "messages"
+	// FormatUsers is a CSV with per-user totals
+	FormatUsers = "users"
+)
+
+// Formats lists the export formats in the order they are offered to the user.
+var Formats = []string{FormatJSON, FormatMessages, FormatUsers}
+
+var messagesHeader = []string{"message_id", "date", "user_id", "user", "status", "category", "label", "confidence", "low_confidence", "content_type", "text"}
+
+var usersHeader = []string{"user_id", "user", "total", "productive", "unproductive", "unclassified", "low_confidence"}
+
+// Export renders the data of the period in a machine-readable format and returns the file name and content.
+// CSV headers are not localized, the locale only affects the texts of the JSON report.
+func (g *ReportGenerator) Export(ctx context.Context, chatID int64, period Period, format, locale string) (string, []byte, error) {
+	name := fmt.Sprintf("report_%d_%s_%s", chatID, period.From.Format(time.DateOnly), period.To.AddDate(0, 0, -1).Format(time.DateOnly))
+
+	if format == FormatJSON {
+		report, err := g.GenerateReport(ctx, chatID, period, locale)
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to encode report: %w", err)
+		}
+		return name + ".json", data, nil
+	}
+
+	settings, err := g.storage.GetChatSettings(ctx, chatID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch chat settings: %w", err)
+	}
+	loc := settings.Location()
+	period = period.In(loc)
+
+	messages, err := g.storage.GetMessagesByChatAndPeriod(ctx, chatID, period.From, period.To)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return "", nil, ErrNoMessages
+	}
+
+	var records [][]string
+	switch format {
+	case FormatMessages:
+		records = g.messageRecords(messages, loc)
+	case FormatUsers:
+		records, err = g.userRecords(ctx, messages)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown export format: %s", format)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := csv.NewWriter(buf).WriteAll(records); err != nil {
+		return "", nil, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return fmt.Sprintf("%s_%s.csv", name, format), buf.Bytes(), nil
+}
+
+// messageRecords writes dates with the offset of the chat timezone.
+func (g *ReportGenerator) messageRecords(messages []*model.Message, loc *time.Location) [][]string {
+	records := [][]string{messagesHeader}
+	for _, msg := range messages {
+		record := []string{
+			strconv.FormatUint(msg.MessageID, 10),
+			msg.Date.In(loc).Format(time.RFC3339),
+			strconv.Itoa(msg.UserID),
+			csvCell(msg.UserFullName),
+			msg.Status,
+			"", "", "", "",
+			messageContentType(msg),
+			csvCell(msg.Content()),
+		}
+		// The label means nothing for unclassified messages
+		if msg.Status != model.MessageStatusPending {
+			category := msg.Category
+			if category == "" {
+				category = model.CategoryForLabel(msg.Label)
+			}
+			record[5] = category
+			record[6] = strconv.FormatUint(uint64(msg.Label), 10)
+			record[7] = strconv.FormatFloat(msg.Confidence, 'f', -1, 64)
+			record[8] = strconv.FormatBool(msg.Confidence < g.minConfidence)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// userRecords groups the messages by user ID and names the users as they are named now.
+func (g *ReportGenerator) userRecords(ctx context.Context, messages []*model.Message) ([][]string, error) {
+	type userTotals struct {
+		total, productive, unproductive, unclassified, lowConfidence int
+	}
+
+	users := make(map[userKey]*userTotals)
+	for _, msg := range messages {
+		key := messageUser(msg)
+		totals, ok := users[key]
+		if !ok {
+			totals = &userTotals{}
+			users[key] = totals
+		}
+
+		totals.total++
+		switch {
+		case msg.Status == model.MessageStatusPending:
+			totals.unclassified++
+		case msg.Confidence < g.minConfidence:
+			totals.lowConfidence++
+		case msg.Label == 1:
+			totals.productive++
+		default:
+			totals.unproductive++
+		}
+	}
+
+	names, err := g.userNames(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]userKey, 0, len(users))
+	for key := range users {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if names[keys[i]] != names[keys[j]] {
+			return names[keys[i]] < names[keys[j]]
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	records := [][]string{usersHeader}
+	for _, key := range keys {
+		totals := users[key]
+		records = append(records, []string{
+			strconv.Itoa(key.id),
+			csvCell(names[key]),
+			strconv.Itoa(totals.total),
+			strconv.Itoa(totals.productive),
+			strconv.Itoa(totals.unproductive),
+			strconv.Itoa(totals.unclassified),
+			strconv.Itoa(totals.lowConfidence),
+		})
+	}
+	return records, nil
+}
+
+// csvCell keeps a text written by a user from running as a formula when the file is opened in a spreadsheet.
+func csvCell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,120 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+)
+
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+
+	// MaxPeriodDays limits the amount of messages loaded for one report
+	MaxPeriodDays = 366
+
+	rangeSeparator = ".."
+)
+
+var ErrInvalidPeriod = errors.New("invalid period")
+
+// Period is the half-open interval [From, To) of whole days. Parsed periods start at midnight UTC,
+// In moves them to the timezone of a chat.
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+func DayPeriod(date time.Time) Period {
+	from := truncateToDay(date)
+	return Period{From: from, To: from.AddDate(0, 0, 1)}
+}
+
+// ParsePeriod parses "week" and "month" (the last 7 and 30 days including today),
+// "YYYY-MM-DD" and "YYYY-MM-DD..YYYY-MM-DD" with an inclusive end.
+func ParsePeriod(arg string, today time.Time) (Period, error) {
+	today = truncateToDay(today)
+
+	switch arg {
+	case PeriodWeek:
+		return Period{From: today.AddDate(0, 0, -6), To: today.AddDate(0, 0, 1)}, nil
+	case PeriodMonth:
+		return Period{From: today.AddDate(0, 0, -29), To: today.AddDate(0, 0, 1)}, nil
+	}
+
+	fromArg, toArg, isRange := strings.Cut(arg, rangeSeparator)
+	from, err := time.Parse(time.DateOnly, fromArg)
+	if err != nil {
+		return Period{}, fmt.Errorf("%w: %q", ErrInvalidPeriod, arg)
+	}
+	if !isRange {
+		return DayPeriod(from), nil
+	}
+
+	to, err := time.Parse(time.DateOnly, toArg)
+	if err != nil {
+		return Period{}, fmt.Errorf("%w: %q", ErrInvalidPeriod, arg)
+	}
+
+	period := Period{From: from, To: to.AddDate(0, 0, 1)}
+	if !period.To.After(period.From) {
+		return Period{}, fmt.Errorf("%w: %q ends before it starts", ErrInvalidPeriod, arg)
+	}
+	if period.Days() > MaxPeriodDays {
+		return Period{}, fmt.Errorf("%w: %q is longer than %d days", ErrInvalidPeriod, arg, MaxPeriodDays)
+	}
+	return period, nil
+}
+
+// Days rounds the length of the period, days may be shorter or longer on daylight saving time changes.
+func (p Period) Days() int {
+	return int(math.Round(p.To.Sub(p.From).Hours() / 24))
+}
+
+// In moves the bounds to midnight of the same dates in loc.
+func (p Period) In(loc *time.Location) Period {
+	return Period{From: dateIn(p.From, loc), To: dateIn(p.To, loc)}
+}
+
+func (p Period) String() string {
+	return p.Format(i18n.DefaultLocale)
+}
+
+// Format renders the period with the date layout of the locale.
+func (p Period) Format(locale string) string {
+	last := p.To.AddDate(0, 0, -1)
+	if !last.After(p.From) {
+		return i18n.FormatDate(locale, p.From)
+	}
+	return fmt.Sprintf("%s – %s", i18n.FormatDate(locale, p.From), i18n.FormatDate(locale, last))
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return dateIn(t, time.UTC)
+}
+
+// dateIn returns midnight in loc of the date of t in its own timezone.
+func dateIn(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// truncateToStep truncates t in loc to the hour, or to the day for steps of a day and longer.
+func truncateToStep(t time.Time, step time.Duration, loc *time.Location) time.Time {
+	t = t.In(loc)
+	if step >= 24*time.Hour {
+		return dateIn(t, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+}
+
+// nextStep advances t by the step keeping days aligned to midnight.
+func nextStep(t time.Time, step time.Duration) time.Time {
+	if step >= 24*time.Hour {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(step)
+}
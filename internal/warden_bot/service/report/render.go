@@ -0,0 +1,109 @@
+package report
+
+import (
+	"html"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// ParseMode is the Telegram parse mode of String and Pages
+	ParseMode = "HTML"
+	// MaxMessageLength is the Telegram limit of a message text in UTF-16 code units
+	MaxMessageLength = 4096
+	// maxSampleLength keeps a single long message from taking a whole page
+	maxSampleLength = 300
+)
+
+// Pages splits the report into messages that fit into the Telegram limit. The report is split between lines,
+// so HTML tags, which never span lines, stay balanced.
+func (r *Report) Pages() []string {
+	return paginate(r.String(), MaxMessageLength)
+}
+
+func paginate(text string, limit int) []string {
+	var pages []string
+	page := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if page != "" && textLength(page+line) > limit {
+			pages = append(pages, strings.TrimRight(page, "\n"))
+			page = ""
+		}
+		// Reports have no lines over the limit, but a cut line is better than an unsent report
+		for textLength(line) > limit {
+			head := truncateToLength(line, limit)
+			pages = append(pages, head)
+			line = line[len(head):]
+		}
+		page += line
+	}
+	if strings.TrimSpace(page) != "" {
+		pages = append(pages, strings.TrimRight(page, "\n"))
+	}
+	return pages
+}
+
+// textLength counts the text the way Telegram does, in UTF-16 code units.
+func textLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// truncateToLength cuts the HTML text to limit UTF-16 code units at a rune boundary, stepping back
+// before a cut entity, a cut tag or a tag left open, which Telegram would refuse to parse.
+func truncateToLength(text string, limit int) string {
+	length := 0
+	for i, char := range text {
+		length++
+		if char >= 0x10000 { // Characters outside of the BMP take two UTF-16 code units
+			length++
+		}
+		if length > limit {
+			if head := balancedPrefix(text[:i]); head != "" {
+				return head
+			}
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// balancedPrefix drops the end of the HTML text starting at an incomplete entity or tag, or at the first tag that is not closed.
+func balancedPrefix(text string) string {
+	if amp := strings.LastIndexByte(text, '&'); amp > strings.LastIndexByte(text, ';') {
+		text = text[:amp]
+	}
+	if lt := strings.LastIndexByte(text, '<'); lt > strings.LastIndexByte(text, '>') {
+		text = text[:lt]
+	}
+
+	var open []int
+	for i := 0; i < len(text); i++ {
+		if text[i] != '<' {
+			continue
+		}
+		if strings.HasPrefix(text[i:], "</") {
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		} else {
+			open = append(open, i)
+		}
+	}
+	if len(open) > 0 {
+		text = text[:open[0]]
+	}
+	return text
+}
+
+func escape(text string) string {
+	return html.EscapeString(text)
+}
+
+// truncate shortens the text to limit characters and marks the cut with an ellipsis.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -2,57 +2,122 @@ package report
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"time"
 
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service/storage"
 )
 
+// ErrNoMessages is returned for periods without messages, the service shows a localized text instead.
+var ErrNoMessages = errors.New("no messages in the period")
+
 type ReportGenerator struct {
-	storage storage.Storage
+	storage       storage.Storage
+	minConfidence float64
 }
 
-func NewReportGenerator(storage storage.Storage) *ReportGenerator {
+func NewReportGenerator(storage storage.Storage, minConfidence float64) *ReportGenerator {
 	return &ReportGenerator{
 		storage,
+		minConfidence,
 	}
 }
 
 type Report struct {
-	Date                       time.Time
-	ChatID                     uint64
-	ChatTitle                  string
-	TotalMessages              int
-	ProductiveMessages         int
-	UnproductiveMessages       int
-	UnproductivePercentage     float64
-	UnproductiveMessageSamples []string
-	TopDistractingUsers        []UserActivity
-	ActivityTimeline           []ActivityPoint
-	ProductivityIndicator      string
+	Period                     Period           `json:"period"`
+	ChatID                     int64            `json:"chatId"`
+	ChatTitle                  string           `json:"chatTitle"`
+	ThreadID                   uint64           `json:"threadId"`
+	TotalMessages              int              `json:"totalMessages"`
+	ProductiveMessages         int              `json:"productiveMessages"`
+	UnproductiveMessages       int              `json:"unproductiveMessages"`
+	UnclassifiedMessages       int              `json:"unclassifiedMessages"`
+	LowConfidenceMessages      int              `json:"lowConfidenceMessages"`
+	CategoryBreakdown          []CategoryCount  `json:"categoryBreakdown"`
+	ContentBreakdown           []ContentCount   `json:"contentBreakdown"`
+	ForwardedMessages          int              `json:"forwardedMessages"`
+	ThreadBreakdown            []ThreadActivity `json:"threadBreakdown"`
+	UnproductivePercentage     float64          `json:"unproductivePercentage"`
+	UnproductiveMessageSamples []string         `json:"unproductiveMessageSamples"`
+	TopDistractingUsers        []UserActivity   `json:"topDistractingUsers"`
+	ActivityTimeline           []ActivityPoint  `json:"activityTimeline"`
+	ProductivityIndicator      string           `json:"productivityIndicator"`
+	Locale                     string           `json:"locale"`
+	// TimelineStep is an hour for short periods and a day for long ones
+	TimelineStep time.Duration `json:"-"`
+	// SampleLimit is the number of samples shown in the text report, the rest are only exported
+	SampleLimit int `json:"-"`
+	// PreviousPeriod, ShortBaseline and LongBaseline are nil when there were no classified messages then
+	PreviousPeriod *Trend `json:"previousPeriod"`
+	ShortBaseline  *Trend `json:"shortBaseline"`
+	LongBaseline   *Trend `json:"longBaseline"`
 }
 
+// hourlyTimelineDays is the longest period whose timeline is grouped by hours
+const hourlyTimelineDays = 2
+
+// UserActivity has a zero UserID for messages saved before user IDs were stored.
 type UserActivity struct {
-	UserName string
-	Count    int
+	UserID   int    `json:"userId"`
+	UserName string `json:"userName"`
+	Count    int    `json:"count"`
+}
+
+type CategoryCount struct {
+	Category      string `json:"category"`
+	Count         int    `json:"count"`
+	LowConfidence int    `json:"lowConfidence"`
+}
+
+// ContentCount counts all messages of the content type, classified or not.
+type ContentCount struct {
+	ContentType string `json:"contentType"`
+	Count       int    `json:"count"`
 }
 
 type ActivityPoint struct {
-	Timestamp time.Time
-	Count     int
+	Timestamp time.Time `json:"timestamp"`
+	Count     int       `json:"count"`
+}
+
+// GenerateReport builds the report of the period, texts are rendered in the locale. Days of the period
+// and of the timeline start at midnight in the timezone of the chat.
+func (g *ReportGenerator) GenerateReport(ctx context.Context, chatID int64, period Period, locale string) (*Report, error) {
+	return g.GenerateThreadReport(ctx, chatID, 0, period, locale)
 }
 
-func (g *ReportGenerator) GenerateReport(ctx context.Context, chatID uint64, date time.Time) (*Report, error) {
+// GenerateThreadReport builds the report of one thread of the chat, zero threadID covers the whole chat
+// and breaks it down by thread.
+func (g *ReportGenerator) GenerateThreadReport(ctx context.Context, chatID int64, threadID uint64, period Period, locale string) (*Report, error) {
+	settings, err := g.storage.GetChatSettings(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch chat settings: %w", err)
+	}
+	loc := settings.Location()
+	period = period.In(loc)
+
 	// Получение всех сообщений за период
-	messages, err := g.storage.GetMessagesByChatAndPeriod(ctx, chatID, date)
+	messages, err := g.storage.GetMessagesByChatAndPeriod(ctx, chatID, period.From, period.To)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch messages: %w", err)
 	}
+	messages = filterThread(messages, threadID)
 
 	if len(messages) == 0 {
-		return nil, fmt.Errorf("В чате не было сообщений за запрашиваемую дату")
+		return nil, ErrNoMessages
+	}
+
+	// The history for comparison with past periods is loaded in one query
+	history := historyPeriod(period)
+	historyMessages, err := g.storage.GetMessagesByChatAndPeriod(ctx, chatID, history.From, history.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message history: %w", err)
 	}
+	historyMessages = filterThread(historyMessages, threadID)
 
 	chatInfo, err := g.storage.GetChatInfoByID(ctx, chatID)
 	if err != nil {
@@ -63,37 +128,113 @@ func (g *ReportGenerator) GenerateReport(ctx context.Context, chatID uint64, dat
 	totalMessages := len(messages)
 	productiveMessages := 0
 	unproductiveMessages := 0
+	unclassifiedMessages := 0
+	lowConfidenceMessages := 0
+	categories := make(map[string]*CategoryCount)
+	contentTypes := make(map[string]int)
+	forwardedMessages := 0
 	unproductiveSamples := []string{}
-	userActivity := make(map[string]int)
+	userActivity := make(map[userKey]int)
 	timeline := make(map[time.Time]int)
 
+	// Activity of long periods is grouped by day
+	timelineStep := time.Hour
+	if period.Days() > hourlyTimelineDays {
+		timelineStep = 24 * time.Hour
+	}
+
 	// Анализ сообщений
 	for _, msg := range messages {
+		contentTypes[messageContentType(msg)]++
+		if msg.IsForwarded() {
+			forwardedMessages++
+		}
+
+		if msg.Status == model.MessageStatusPending { // The model has not labeled it yet
+			unclassifiedMessages++
+			continue
+		}
+
+		category := msg.Category
+		if category == "" { // Messages labeled before categories existed
+			category = model.CategoryForLabel(msg.Label)
+		}
+		if categories[category] == nil {
+			categories[category] = &CategoryCount{Category: category}
+		}
+
+		if msg.Confidence < g.minConfidence { // An uncertain prediction is not counted as reliable
+			lowConfidenceMessages++
+			categories[category].LowConfidence++
+			continue
+		}
+		categories[category].Count++
+
 		if msg.Label == 1 { // Label 1 - продуктивное сообщение
 			productiveMessages++
 		} else if msg.Label == 0 { // Label 0 - непродуктивное сообщение
 			unproductiveMessages++
-			unproductiveSamples = append(unproductiveSamples, msg.Text)
-			userActivity[msg.UserFullName]++
-			timeline[msg.Date.Truncate(time.Hour)]++ // Группировка по часам
+			unproductiveSamples = append(unproductiveSamples, msg.Content())
+			userActivity[messageUser(msg)]++
+			timeline[truncateToStep(msg.Date, timelineStep, loc)]++
 		}
 	}
 
-	// Расчет процента непродуктивных сообщений
+	// Share of unproductive messages among the confidently classified ones
 	unproductivePercentage := 0.0
-	if totalMessages > 0 {
-		unproductivePercentage = float64(unproductiveMessages) / float64(totalMessages) * 100
+	if classifiedMessages := productiveMessages + unproductiveMessages; classifiedMessages > 0 {
+		unproductivePercentage = float64(unproductiveMessages) / float64(classifiedMessages) * 100
+	}
+
+	// Users are grouped by ID, the report shows their current name
+	names, err := g.userNames(ctx, messages)
+	if err != nil {
+		return nil, err
 	}
 
 	// Сортировка пользователей с наибольшим количеством непродуктивных сообщений
 	topUsers := []UserActivity{}
 	for user, count := range userActivity {
-		topUsers = append(topUsers, UserActivity{UserName: user, Count: count})
+		topUsers = append(topUsers, UserActivity{UserID: user.id, UserName: names[user], Count: count})
 	}
-	// Сортировка по убыванию
+	// Descending order, ties by name, so the truncated list is stable
 	sort.Slice(topUsers, func(i, j int) bool {
-		return topUsers[i].Count > topUsers[j].Count
+		if topUsers[i].Count != topUsers[j].Count {
+			return topUsers[i].Count > topUsers[j].Count
+		}
+		if topUsers[i].UserName != topUsers[j].UserName {
+			return topUsers[i].UserName < topUsers[j].UserName
+		}
+		return topUsers[i].UserID < topUsers[j].UserID
+	})
+	if len(topUsers) > settings.TopUsersLimit {
+		topUsers = topUsers[:settings.TopUsersLimit]
+	}
+
+	// Breakdown by category in the order of model.Categories, unknown categories last
+	categoryBreakdown := []CategoryCount{}
+	for _, category := range model.Categories {
+		if count, ok := categories[category]; ok {
+			categoryBreakdown = append(categoryBreakdown, *count)
+			delete(categories, category)
+		}
+	}
+	unknownCategories := []CategoryCount{}
+	for _, count := range categories {
+		unknownCategories = append(unknownCategories, *count)
+	}
+	sort.Slice(unknownCategories, func(i, j int) bool {
+		return unknownCategories[i].Category < unknownCategories[j].Category
 	})
+	categoryBreakdown = append(categoryBreakdown, unknownCategories...)
+
+	// Breakdown by content type in the order of model.ContentTypes
+	contentBreakdown := []ContentCount{}
+	for _, contentType := range model.ContentTypes {
+		if count := contentTypes[contentType]; count > 0 {
+			contentBreakdown = append(contentBreakdown, ContentCount{ContentType: contentType, Count: count})
+		}
+	}
 
 	// Подготовка временной активности
 	activityTimeline := []ActivityPoint{}
@@ -105,92 +246,182 @@ func (g *ReportGenerator) GenerateReport(ctx context.Context, chatID uint64, dat
 		return activityTimeline[i].Timestamp.Before(activityTimeline[j].Timestamp)
 	})
 
-	// Индикатор продуктивности
-	productivityIndicator := "Нормально"
-	if unproductivePercentage > 50 {
-		productivityIndicator = "Низкая продуктивность"
-	} else if unproductivePercentage < 20 {
-		productivityIndicator = "Высокая продуктивность"
+	// The thread breakdown only makes sense for a report on the whole chat
+	threadBreakdown := []ThreadActivity{}
+	if threadID == 0 {
+		threadBreakdown = g.threadActivity(messages)
+	}
+
+	// Productivity indicator by the thresholds of the chat
+	highLabel, normalLabel, lowLabel := IndicatorLabels(settings, locale)
+	productivityIndicator := normalLabel
+	if unproductivePercentage > settings.LowProductivityAbove {
+		productivityIndicator = lowLabel
+	} else if unproductivePercentage < settings.HighProductivityBelow {
+		productivityIndicator = highLabel
 	}
 
 	// Создание отчета
 	report := &Report{
-		Date:                       date,
+		Period:                     period,
 		ChatID:                     chatID,
 		ChatTitle:                  chatInfo.Title,
+		ThreadID:                   threadID,
 		TotalMessages:              totalMessages,
 		ProductiveMessages:         productiveMessages,
 		UnproductiveMessages:       unproductiveMessages,
+		UnclassifiedMessages:       unclassifiedMessages,
+		LowConfidenceMessages:      lowConfidenceMessages,
+		CategoryBreakdown:          categoryBreakdown,
+		ContentBreakdown:           contentBreakdown,
+		ForwardedMessages:          forwardedMessages,
+		ThreadBreakdown:            threadBreakdown,
 		UnproductivePercentage:     unproductivePercentage,
 		UnproductiveMessageSamples: unproductiveSamples,
 		TopDistractingUsers:        topUsers,
 		ActivityTimeline:           activityTimeline,
 		ProductivityIndicator:      productivityIndicator,
+		Locale:                     locale,
+		TimelineStep:               timelineStep,
+		SampleLimit:                settings.SampleLimit,
 	}
 
+	// Comparison with the previous period and moving averages
+	previous, shortBaseline, longBaseline := comparisonPeriods(period)
+	report.PreviousPeriod = g.newTrend(report, historyMessages, previous)
+	report.ShortBaseline = g.newTrend(report, historyMessages, shortBaseline)
+	report.LongBaseline = g.newTrend(report, historyMessages, longBaseline)
+
 	return report, nil
 }
 
+// String renders the report as Telegram HTML, user content is escaped. Use Pages to send it.
 func (r *Report) String() string {
-	reportText := fmt.Sprintf(
-		"📊 *Отчет по чату*: %s за %s\n\n"+
-			"📋 *Общая статистика:*\n"+
-			"Всего сообщений: %d\n"+
-			"Продуктивных сообщений: %d\n"+
-			"Непродуктивных сообщений: %d\n"+
-			"Процент непродуктивных сообщений: %.2f%%\n\n"+
-			"🚫 *Примеры непродуктивных сообщений:*\n%s\n\n"+
-			"👥 *Пользователи с наибольшим количеством непродуктивных сообщений:*\n%s\n\n"+
-			"📈 *Активность непродуктивных сообщений по времени:*\n%s\n\n"+
-			"📌 *Индикатор продуктивности*: %s",
-		r.ChatTitle,
-		r.Date.Format("02.01.2006"),
+	title := escape(r.ChatTitle)
+	if r.ThreadID != 0 {
+		title += i18n.T(r.Locale, "report.thread_title", r.ThreadID)
+	}
+
+	reportText := i18n.T(r.Locale, "report.text",
+		title,
+		r.Period.Format(r.Locale),
 		r.TotalMessages,
 		r.ProductiveMessages,
 		r.UnproductiveMessages,
+		r.UnclassifiedMessages,
+		r.LowConfidenceMessages,
 		r.UnproductivePercentage,
-		formatExamples(r.UnproductiveMessageSamples),
-		formatTopUsers(r.TopDistractingUsers),
-		formatActivityTimeline(r.ActivityTimeline),
-		r.ProductivityIndicator,
+		formatCategories(r.Locale, r.CategoryBreakdown),
+		formatContentTypes(r.Locale, r.ContentBreakdown, r.ForwardedMessages),
+		formatThreads(r.Locale, r.ThreadBreakdown),
+		formatExamples(r.Locale, r.UnproductiveMessageSamples, r.SampleLimit),
+		formatTopUsers(r.Locale, r.TopDistractingUsers),
+		formatActivityTimeline(r.Locale, r.ActivityTimeline, r.TimelineStep),
+		formatTrends(r),
+		escape(r.ProductivityIndicator),
 	)
 
 	return reportText
 }
 
-func formatExamples(examples []string) string {
+func formatExamples(locale string, examples []string, limit int) string {
 	if len(examples) == 0 {
-		return "Нет примеров."
+		return i18n.T(locale, "report.no_samples")
+	}
+	if limit <= 0 {
+		limit = model.DefaultSampleLimit
 	}
 	result := ""
 	for i, example := range examples {
-		if i >= 10 {
-			result += "и другие...\n"
+		if i >= limit {
+			result += i18n.T(locale, "report.more_samples") + "\n"
 			break
 		}
-		result += fmt.Sprintf("- %s\n", example)
+		result += fmt.Sprintf("- %s\n", escape(truncate(example, maxSampleLength)))
+	}
+	return result
+}
+
+// categoryKeys are the catalog keys of the known categories
+var categoryKeys = map[string]string{
+	model.CategoryWork:     "category.work",
+	model.CategoryQuestion: "category.question",
+	model.CategoryOffTopic: "category.off_topic",
+	model.CategorySpam:     "category.spam",
+	model.CategoryToxic:    "category.toxic",
+}
+
+func formatCategories(locale string, categories []CategoryCount) string {
+	if len(categories) == 0 {
+		return i18n.T(locale, "report.no_categories")
+	}
+	result := ""
+	for _, category := range categories {
+		name := escape(category.Category)
+		if key, ok := categoryKeys[category.Category]; ok {
+			name = i18n.T(locale, key)
+		}
+		result += i18n.T(locale, "report.category", name, category.Count)
+		if category.LowConfidence > 0 {
+			result += i18n.T(locale, "report.category_uncertain", category.LowConfidence)
+		}
+		result += "\n"
 	}
 	return result
 }
 
-func formatTopUsers(users []UserActivity) string {
+// messageContentType treats messages saved before content types were stored as text.
+func messageContentType(msg *model.Message) string {
+	if msg.ContentType == "" {
+		return model.ContentTypeText
+	}
+	return msg.ContentType
+}
+
+func formatContentTypes(locale string, contentTypes []ContentCount, forwarded int) string {
+	result := ""
+	for _, count := range contentTypes {
+		result += i18n.T(locale, "report.count", i18n.T(locale, "content."+count.ContentType), count.Count) + "\n"
+	}
+	return result + i18n.T(locale, "report.forwarded", forwarded)
+}
+
+func formatTopUsers(locale string, users []UserActivity) string {
 	if len(users) == 0 {
-		return "Нет пользователей с непродуктивными сообщениями."
+		return i18n.T(locale, "report.no_users")
 	}
 	result := ""
 	for _, user := range users {
-		result += fmt.Sprintf("- %s: %d сообщений\n", user.UserName, user.Count)
+		result += i18n.T(locale, "report.count", escape(user.UserName), user.Count) + "\n"
 	}
 	return result
 }
 
-func formatActivityTimeline(timeline []ActivityPoint) string {
+func formatActivityTimeline(locale string, timeline []ActivityPoint, step time.Duration) string {
 	if len(timeline) == 0 {
-		return "Нет данных о временной активности."
+		return i18n.T(locale, "report.no_timeline")
+	}
+	format := i18n.FormatDateTime
+	if step >= 24*time.Hour {
+		format = i18n.FormatDate
 	}
 	result := ""
 	for _, point := range timeline {
-		result += fmt.Sprintf("- %s: %d сообщений\n", point.Timestamp.Format("01.02.2006 15:00"), point.Count)
+		result += i18n.T(locale, "report.count", format(locale, point.Timestamp), point.Count) + "\n"
 	}
 	return result
 }
+
+// IndicatorLabels returns the productivity indicator labels of the chat with the built-in ones in place of empty labels.
+func IndicatorLabels(settings *model.ChatSettings, locale string) (high, normal, low string) {
+	return labelOrDefault(settings.HighLabel, i18n.T(locale, "indicator.high")),
+		labelOrDefault(settings.NormalLabel, i18n.T(locale, "indicator.normal")),
+		labelOrDefault(settings.LowLabel, i18n.T(locale, "indicator.low"))
+}
+
+func labelOrDefault(label, defaultLabel string) string {
+	if label == "" {
+		return defaultLabel
+	}
+	return label
+}
@@ -0,0 +1,561 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/g3ksa/warden_bot/mocks/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateReport(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	period := DayPeriod(date)
+
+	t.Run("Unclassified messages", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0.6)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "deploy", Date: date, Label: 1, Category: model.CategoryWork, Confidence: 0.9, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserFullName: "John Doe", Text: "lol", Date: date, Label: 0, Category: model.CategoryOffTopic, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 3, UserFullName: "Jane Doe", Text: "new", Date: date, Label: 0, Status: model.MessageStatusPending},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, report.TotalMessages)
+		assert.Equal(t, 1, report.ProductiveMessages)
+		assert.Equal(t, 1, report.UnproductiveMessages)
+		assert.Equal(t, 1, report.UnclassifiedMessages)
+		assert.Equal(t, 50.0, report.UnproductivePercentage)
+		assert.Equal(t, []UserActivity{{UserName: "John Doe", Count: 1}}, report.TopDistractingUsers)
+		assert.Contains(t, report.String(), "Еще не классифицировано: 1")
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Categories and low confidence", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0.6)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "how?", Date: date, Label: 1, Category: model.CategoryQuestion, Confidence: 0.8, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserFullName: "John Doe", Text: "buy now", Date: date, Label: 0, Category: model.CategorySpam, Confidence: 0.95, Status: model.MessageStatusClassified},
+			{MessageID: 3, UserFullName: "Jane Doe", Text: "hmm", Date: date, Label: 0, Category: model.CategorySpam, Confidence: 0.3, Status: model.MessageStatusClassified},
+			{MessageID: 4, UserFullName: "Jane Doe", Text: "old", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, report.ProductiveMessages)
+		assert.Equal(t, 1, report.UnproductiveMessages)
+		assert.Equal(t, 1, report.LowConfidenceMessages)
+		assert.Equal(t, []CategoryCount{
+			{Category: model.CategoryWork, Count: 1},
+			{Category: model.CategoryQuestion, Count: 1},
+			{Category: model.CategorySpam, Count: 1, LowConfidence: 1},
+		}, report.CategoryBreakdown)
+		assert.Contains(t, report.String(), "- Спам: 1 сообщений (+1 под вопросом)")
+	})
+
+	t.Run("Long period timeline by days", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+		period := Period{From: date, To: date.AddDate(0, 0, 7)}
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "lol", Date: date.Add(10 * time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserFullName: "John Doe", Text: "kek", Date: date.Add(15 * time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 3, UserFullName: "Jane Doe", Text: "meme", Date: date.AddDate(0, 0, 3).Add(time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, []ActivityPoint{
+			{Timestamp: date, Count: 2},
+			{Timestamp: date.AddDate(0, 0, 3), Count: 1},
+		}, report.ActivityTimeline)
+		assert.Contains(t, report.String(), "за 01.12.2024 – 07.12.2024")
+		assert.Contains(t, report.String(), "- 04.12.2024: 1 сообщений")
+	})
+
+	t.Run("Trends", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+
+		messages := []*model.Message{
+			{MessageID: 10, UserFullName: "John Doe", Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 11, UserFullName: "John Doe", Text: "lol", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		history := []*model.Message{
+			// The previous day: all messages are unproductive
+			{MessageID: 8, UserFullName: "John Doe", Text: "lol", Date: date.Add(-time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 9, UserFullName: "John Doe", Text: "kek", Date: date.Add(-2 * time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			// Two weeks ago: only productive ones
+			{MessageID: 1, UserFullName: "Jane Doe", Text: "review", Date: date.AddDate(0, 0, -14), Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserFullName: "Jane Doe", Text: "merge", Date: date.AddDate(0, 0, -14), Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return(history, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, &Trend{
+			Period:                      Period{From: date.AddDate(0, 0, -1), To: date},
+			TotalMessages:               2,
+			DailyMessages:               2,
+			UnproductivePercentage:      100,
+			UnproductivePercentageDelta: -50,
+		}, report.PreviousPeriod)
+		assert.Equal(t, 100.0, report.ShortBaseline.UnproductivePercentage)
+		assert.Equal(t, 50.0, report.LongBaseline.UnproductivePercentage)
+		assert.InDelta(t, 2-4.0/30, report.LongBaseline.DailyMessagesDelta, 1e-9)
+		assert.Contains(t, report.String(), "- Предыдущий период (30.11.2024): непродуктивных 100.00% ⬇️ -50.00 п.п., сообщений в день 2.0 ➡️ +0.0")
+		assert.Contains(t, report.String(), "- Среднее за 30 дней (01.11.2024 – 30.11.2024): непродуктивных 50.00% ➡️ +0.00 п.п.")
+	})
+
+	t.Run("Chat settings", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "lol", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserFullName: "John Doe", Text: "kek", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 3, UserFullName: "Jane Doe", Text: "meme", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 4, UserFullName: "Jane Doe", Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		settings := &model.ChatSettings{ChatID: -1, HighProductivityBelow: 80, LowProductivityAbove: 90, SampleLimit: 1, TopUsersLimit: 1, HighLabel: "<Отлично>"}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(settings, nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, "<Отлично>", report.ProductivityIndicator)
+		assert.Equal(t, []UserActivity{{UserName: "John Doe", Count: 2}}, report.TopDistractingUsers)
+		assert.Len(t, report.UnproductiveMessageSamples, 3)
+		assert.Contains(t, report.String(), "- lol\nи другие...")
+		assert.Contains(t, report.String(), "&lt;Отлично&gt;")
+	})
+
+	t.Run("English locale", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "lol", Date: date, Label: 0, Category: model.CategorySpam, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.LocaleEn)
+		assert.NoError(t, err)
+		assert.Equal(t, "Low productivity", report.ProductivityIndicator)
+		assert.Contains(t, report.String(), "<b>Chat report</b>: Chat for Dec 1, 2024")
+		assert.Contains(t, report.String(), "- Spam: 1 messages")
+		assert.Contains(t, report.String(), "- Dec 1, 2024 00:00: 1 messages")
+		assert.NotContains(t, report.String(), "сообщений")
+	})
+
+	t.Run("Users grouped by ID", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserID: 7, UserFullName: "John Doe", Text: "lol", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserID: 7, UserFullName: "Johnny", Text: "kek", Date: date.Add(time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 3, UserID: 8, UserFullName: "John Doe", Text: "meme", Date: date.Add(time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			// A message saved before user IDs were stored
+			{MessageID: 4, UserFullName: "John Doe", Text: "old", Date: date.Add(time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetUsersByIDs", ctx, []int{7, 8}).Return([]model.User{{UserID: 7, Username: "jdoe", FullName: "John Doe"}}, nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, []UserActivity{
+			{UserID: 7, UserName: "John Doe (@jdoe)", Count: 2},
+			{UserID: 0, UserName: "John Doe", Count: 1},
+			{UserID: 8, UserName: "John Doe", Count: 1},
+		}, report.TopDistractingUsers)
+	})
+
+	t.Run("Chat timezone", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		assert.NoError(t, err)
+		from := time.Date(2024, 12, 1, 0, 0, 0, 0, tokyo)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "lol", Date: time.Date(2024, 12, 1, 14, 30, 0, 0, time.UTC), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		settings := model.DefaultChatSettings(-1)
+		settings.Timezone = "Asia/Tokyo"
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(settings, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), from, from.AddDate(0, 0, 1)).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), from.AddDate(0, 0, -30), from).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, from, report.Period.From)
+		assert.Contains(t, report.String(), "за 01.12.2024\n")
+		assert.Contains(t, report.String(), "- 01.12.2024 23:00: 1 сообщений")
+	})
+
+	t.Run("Content types", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserFullName: "John Doe", ContentType: model.ContentTypeSticker, Date: date, Status: model.MessageStatusPending},
+			{MessageID: 3, UserFullName: "John Doe", ContentType: model.ContentTypeSticker, Date: date, Status: model.MessageStatusPending, ForwardFromUserID: 8},
+			{MessageID: 4, UserFullName: "John Doe", ContentType: model.ContentTypePhoto, Caption: "meme", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, []ContentCount{
+			{ContentType: model.ContentTypeText, Count: 1},
+			{ContentType: model.ContentTypePhoto, Count: 1},
+			{ContentType: model.ContentTypeSticker, Count: 2},
+		}, report.ContentBreakdown)
+		assert.Equal(t, 1, report.ForwardedMessages)
+		assert.Equal(t, []string{"meme"}, report.UnproductiveMessageSamples)
+		assert.Contains(t, report.String(), "- Стикеры: 2 сообщений\nПересланных сообщений: 1")
+	})
+
+	t.Run("Threads", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+
+		messages := []*model.Message{
+			{MessageID: 1, UserFullName: "John Doe", Text: "release plan", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserFullName: "John Doe", Text: "lol", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 3, UserFullName: "John Doe", Text: "kek", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified, ThreadID: 1},
+			{MessageID: 4, UserFullName: "John Doe", Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified, ThreadID: 1},
+			// A forum topic created before the period
+			{MessageID: 5, UserFullName: "John Doe", Text: "meme", Date: date, Status: model.MessageStatusPending, ThreadID: 100},
+		}
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		report, err := generator.GenerateReport(ctx, -1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, []ThreadActivity{
+			{ThreadID: 1, Title: "release plan", Count: 3, UnproductiveMessages: 1},
+			{ThreadID: 0, Count: 1, UnproductiveMessages: 1},
+			{ThreadID: 100, Count: 1},
+		}, report.ThreadBreakdown)
+		assert.Contains(t, report.String(), "- #1 release plan: 3 сообщений, непродуктивных 1\n- Вне веток: 1 сообщений")
+
+		threadReport, err := generator.GenerateThreadReport(ctx, -1, 1, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), threadReport.ThreadID)
+		assert.Equal(t, 3, threadReport.TotalMessages)
+		assert.Empty(t, threadReport.ThreadBreakdown)
+		assert.Contains(t, threadReport.String(), "Chat (ветка #1) за")
+
+		_, err = generator.GenerateThreadReport(ctx, -1, 42, period, i18n.DefaultLocale)
+		assert.ErrorIs(t, err, ErrNoMessages)
+	})
+}
+
+func TestGenerateUserReport(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	period := DayPeriod(date)
+	user := &model.User{UserID: 7, Username: "jdoe", FullName: "John Doe"}
+	chats := []model.Chat{{ChatID: -1, Title: "Chat 1"}, {ChatID: -2, Title: "Chat 2"}}
+
+	t.Run("Messages from several chats", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		assert.NoError(t, err)
+		tokyoPeriod := period.In(tokyo)
+
+		settings := model.DefaultChatSettings(-2)
+		settings.Timezone = "Asia/Tokyo"
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-2)).Return(settings, nil)
+		mockStorage.On("GetMessagesByUserAndPeriod", ctx, 7, int64(-1), period.From, period.To).Return([]*model.Message{
+			{MessageID: 1, UserID: 7, Text: "work", Date: date.Add(9 * time.Hour), Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 2, UserID: 7, Text: "lol", Date: date.Add(9 * time.Hour), Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetMessagesByUserAndPeriod", ctx, 7, int64(-2), tokyoPeriod.From, tokyoPeriod.To).Return([]*model.Message{
+			{MessageID: 3, UserID: 7, Text: "new", Date: date.Add(time.Hour), Status: model.MessageStatusPending},
+		}, nil)
+
+		report, err := generator.GenerateUserReport(ctx, user, chats, period, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, "John Doe (@jdoe)", report.UserName)
+		assert.Equal(t, 3, report.TotalMessages)
+		assert.Equal(t, 1, report.UnclassifiedMessages)
+		assert.Equal(t, 50.0, report.ProductivePercentage)
+		assert.Equal(t, 2, report.HourlyActivity[9])
+		// 01:00 UTC in the Tokyo chat
+		assert.Equal(t, 1, report.HourlyActivity[10])
+		assert.Equal(t, []UserChatActivity{
+			{ChatID: -1, ChatTitle: "Chat 1", TotalMessages: 2, UnproductiveMessages: 1},
+			{ChatID: -2, ChatTitle: "Chat 2", TotalMessages: 1},
+		}, report.Chats)
+		assert.Equal(t, []string{"lol"}, report.UnproductiveMessageSamples)
+		assert.Contains(t, report.String(), "- Chat 1: 2 сообщений, непродуктивных 1")
+	})
+
+	t.Run("No messages", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0)
+
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetMessagesByUserAndPeriod", ctx, 7, int64(-1), period.From, period.To).Return([]*model.Message{}, nil)
+
+		_, err := generator.GenerateUserReport(ctx, user, chats[:1], period, i18n.DefaultLocale)
+		assert.ErrorIs(t, err, ErrNoMessages)
+	})
+}
+
+func TestParsePeriod(t *testing.T) {
+	today := time.Date(2026, 9, 30, 15, 4, 0, 0, time.UTC)
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		arg     string
+		want    Period
+		wantErr bool
+	}{
+		{arg: "week", want: Period{From: day(9, 24), To: day(10, 1)}},
+		{arg: "month", want: Period{From: day(9, 1), To: day(10, 1)}},
+		{arg: "2026-09-15", want: Period{From: day(9, 15), To: day(9, 16)}},
+		{arg: "2026-09-01..2026-09-30", want: Period{From: day(9, 1), To: day(10, 1)}},
+		{arg: "2026-09-30..2026-09-01", wantErr: true},
+		{arg: "2024-01-01..2026-09-01", wantErr: true},
+		{arg: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			period, err := ParsePeriod(tt.arg, today)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPeriod)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, period)
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	period := DayPeriod(date)
+	messages := []*model.Message{
+		{MessageID: 1, UserID: 7, UserFullName: "John Doe", Text: "deploy, now", Date: date, Label: 1, Category: model.CategoryWork, Confidence: 0.9, Status: model.MessageStatusClassified},
+		{MessageID: 2, UserID: 7, UserFullName: "John Doe", ContentType: model.ContentTypePhoto, Caption: "lol", Date: date, Label: 0, Category: model.CategoryOffTopic, Confidence: 0.3, Status: model.MessageStatusClassified},
+		{MessageID: 3, UserFullName: "Jane Doe", Text: "new", Date: date, Status: model.MessageStatusPending},
+	}
+	users := []model.User{{UserID: 7, Username: "jsmith", FullName: "John Smith"}}
+
+	t.Run("Messages", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0.6)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+
+		name, data, err := generator.Export(ctx, -1, period, FormatMessages, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, "report_-1_2024-12-01_2024-12-01_messages.csv", name)
+		assert.Equal(t, "message_id,date,user_id,user,status,category,label,confidence,low_confidence,content_type,text\n"+
+			"1,2024-12-01T10:00:00Z,7,John Doe,classified,work,1,0.9,false,text,\"deploy, now\"\n"+
+			"2,2024-12-01T10:00:00Z,7,John Doe,classified,off_topic,0,0.3,true,photo,lol\n"+
+			"3,2024-12-01T10:00:00Z,0,Jane Doe,pending,,,,,text,new\n", string(data))
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0.6)
+		mockStorage.On("GetUsersByIDs", ctx, []int{7}).Return(users, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+
+		_, data, err := generator.Export(ctx, -1, period, FormatUsers, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, "user_id,user,total,productive,unproductive,unclassified,low_confidence\n"+
+			"0,Jane Doe,1,0,0,1,0\n"+
+			"7,John Smith (@jsmith),2,1,0,0,1\n", string(data))
+	})
+
+	t.Run("Formulas are escaped", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0.6)
+		formulas := []*model.Message{
+			{MessageID: 4, UserID: 8, UserFullName: "=HYPERLINK(\"http://x\")", Text: "=1+2", Date: date, Status: model.MessageStatusPending},
+			{MessageID: 5, UserID: 8, UserFullName: "=HYPERLINK(\"http://x\")", Text: "+1", Date: date, Status: model.MessageStatusPending},
+			{MessageID: 6, UserID: 8, UserFullName: "=HYPERLINK(\"http://x\")", Text: "-1", Date: date, Status: model.MessageStatusPending},
+			{MessageID: 7, UserID: 8, UserFullName: "=HYPERLINK(\"http://x\")", Text: "@all", Date: date, Status: model.MessageStatusPending},
+		}
+		mockStorage.On("GetUsersByIDs", ctx, []int{8}).Return([]model.User{{UserID: 8, FullName: "@admin"}}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(formulas, nil)
+
+		_, data, err := generator.Export(ctx, -1, period, FormatMessages, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, "message_id,date,user_id,user,status,category,label,confidence,low_confidence,content_type,text\n"+
+			"4,2024-12-01T10:00:00Z,8,\"'=HYPERLINK(\"\"http://x\"\")\",pending,,,,,text,'=1+2\n"+
+			"5,2024-12-01T10:00:00Z,8,\"'=HYPERLINK(\"\"http://x\"\")\",pending,,,,,text,'+1\n"+
+			"6,2024-12-01T10:00:00Z,8,\"'=HYPERLINK(\"\"http://x\"\")\",pending,,,,,text,'-1\n"+
+			"7,2024-12-01T10:00:00Z,8,\"'=HYPERLINK(\"\"http://x\"\")\",pending,,,,,text,'@all\n", string(data))
+
+		_, data, err = generator.Export(ctx, -1, period, FormatUsers, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, "user_id,user,total,productive,unproductive,unclassified,low_confidence\n"+
+			"8,'@admin,4,0,0,4,0\n", string(data))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0.6)
+		mockStorage.On("GetUsersByIDs", ctx, []int{7}).Return(users, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From.AddDate(0, 0, -30), period.From).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+
+		name, data, err := generator.Export(ctx, -1, period, FormatJSON, i18n.DefaultLocale)
+		assert.NoError(t, err)
+		assert.Equal(t, "report_-1_2024-12-01_2024-12-01.json", name)
+
+		var decoded map[string]any
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, "Chat", decoded["chatTitle"])
+		assert.Equal(t, 3.0, decoded["totalMessages"])
+		assert.Equal(t, "2024-12-01T00:00:00Z", decoded["period"].(map[string]any)["from"])
+		assert.Nil(t, decoded["previousPeriod"])
+	})
+
+	t.Run("Empty period", func(t *testing.T) {
+		mockStorage := new(storage.MockStorage)
+		generator := NewReportGenerator(mockStorage, 0.6)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), period.From, period.To).Return([]*model.Message{}, nil)
+
+		_, _, err := generator.Export(ctx, -1, period, FormatUsers, i18n.DefaultLocale)
+		assert.ErrorIs(t, err, ErrNoMessages)
+	})
+}
+
+func TestRenderChart(t *testing.T) {
+	from := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	report := &Report{
+		Period:                 DayPeriod(from),
+		TimelineStep:           time.Hour,
+		ProductiveMessages:     3,
+		UnproductiveMessages:   1,
+		UnproductivePercentage: 25,
+		ActivityTimeline:       []ActivityPoint{{Timestamp: from.Add(13 * time.Hour), Count: 1}},
+	}
+
+	data, err := RenderChart(report)
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, chartWidth, chartHeight), img.Bounds())
+
+	// The 13:00 column and the bottom of the right column
+	barWidth := (chartWidth - splitWidth - 3*chartMargin) / 24
+	assert.Equal(t, unproductiveColor, img.At(chartMargin+13*barWidth+barWidth/2, chartHeight-chartMargin-1))
+	assert.Equal(t, productiveColor, img.At(chartWidth-chartMargin-splitWidth/2, chartHeight-chartMargin-1))
+}
+
+func TestReportPages(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("User content is escaped", func(t *testing.T) {
+		report := &Report{
+			Period:                     DayPeriod(from),
+			ChatTitle:                  "<b>Dev & Ops</b>",
+			UnproductiveMessageSamples: []string{"*bold* _italic_ [link](x) <i>"},
+			TopDistractingUsers:        []UserActivity{{UserName: "John <script>", Count: 1}},
+		}
+
+		pages := report.Pages()
+		assert.Len(t, pages, 1)
+		assert.Contains(t, pages[0], "<b>Отчет по чату</b>: &lt;b&gt;Dev &amp; Ops&lt;/b&gt;")
+		assert.Contains(t, pages[0], "- *bold* _italic_ [link](x) &lt;i&gt;")
+		assert.Contains(t, pages[0], "- John &lt;script&gt;: 1 сообщений")
+	})
+
+	t.Run("Long report is split between lines", func(t *testing.T) {
+		report := &Report{Period: Period{From: from, To: from.AddDate(0, 0, 366)}, TimelineStep: 24 * time.Hour}
+		for i := 0; i < 366; i++ {
+			report.ActivityTimeline = append(report.ActivityTimeline, ActivityPoint{Timestamp: from.AddDate(0, 0, i), Count: 1000 + i})
+		}
+		for i := 0; i < 10; i++ {
+			report.UnproductiveMessageSamples = append(report.UnproductiveMessageSamples, strings.Repeat("😀", 1000))
+		}
+
+		pages := report.Pages()
+		assert.Greater(t, len(pages), 1)
+		for _, page := range pages {
+			assert.LessOrEqual(t, len(utf16.Encode([]rune(page))), MaxMessageLength)
+			assert.Equal(t, strings.Count(page, "<b>"), strings.Count(page, "</b>"))
+		}
+		// Splitting only loses the line breaks at page boundaries
+		assert.Equal(t, strings.ReplaceAll(report.String(), "\n", ""), strings.ReplaceAll(strings.Join(pages, ""), "\n", ""))
+
+		// A line over the limit is not cut inside an entity or a tag
+		line := escape(strings.Repeat("&", 800)) + "<b>" + escape(strings.Repeat("&<", 100)) + "</b>" + escape(strings.Repeat("&", 3000))
+		pages = paginate(line, MaxMessageLength)
+		assert.Greater(t, len(pages), 1)
+		for _, page := range pages {
+			assert.LessOrEqual(t, len(utf16.Encode([]rune(page))), MaxMessageLength)
+			assert.Equal(t, strings.Count(page, "&"), strings.Count(page, "&amp;")+strings.Count(page, "&lt;"))
+			assert.Equal(t, strings.Count(page, "<b>"), strings.Count(page, "</b>"))
+		}
+		assert.Equal(t, line, strings.Join(pages, ""))
+	})
+}
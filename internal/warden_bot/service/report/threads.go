@@ -0,0 +1,125 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+const (
+	// maxThreads is the number of the busiest threads shown in the text report
+	maxThreads = 10
+	// maxThreadTitleLength keeps thread titles on one line
+	maxThreadTitleLength = 40
+)
+
+// ThreadActivity has a zero ThreadID for the messages outside of threads. Title is the text of the first
+// message of the thread when it was sent in the period.
+type ThreadActivity struct {
+	ThreadID             uint64 `json:"threadId"`
+	Title                string `json:"title"`
+	Count                int    `json:"count"`
+	UnproductiveMessages int    `json:"unproductiveMessages"`
+}
+
+// threadRoots returns the first messages of the threads that have replies among the messages.
+func threadRoots(messages []*model.Message) map[uint64]bool {
+	roots := make(map[uint64]bool)
+	for _, msg := range messages {
+		if msg.ThreadID != 0 {
+			roots[msg.ThreadID] = true
+		}
+	}
+	return roots
+}
+
+// messageThread counts the first message of a thread as a part of it although it is not a reply itself.
+func messageThread(msg *model.Message, roots map[uint64]bool) uint64 {
+	if msg.ThreadID == 0 && roots[msg.MessageID] {
+		return msg.MessageID
+	}
+	return msg.ThreadID
+}
+
+// filterThread keeps the messages of the thread, zero threadID keeps all messages.
+func filterThread(messages []*model.Message, threadID uint64) []*model.Message {
+	if threadID == 0 {
+		return messages
+	}
+	roots := map[uint64]bool{threadID: true}
+	filtered := make([]*model.Message, 0)
+	for _, msg := range messages {
+		if messageThread(msg, roots) == threadID {
+			filtered = append(filtered, msg)
+		}
+	}
+	return filtered
+}
+
+// threadActivity groups the messages by thread, the busiest threads go first. Chats without threads
+// get an empty breakdown.
+func (g *ReportGenerator) threadActivity(messages []*model.Message) []ThreadActivity {
+	roots := threadRoots(messages)
+	if len(roots) == 0 {
+		return []ThreadActivity{}
+	}
+
+	threads := make(map[uint64]*ThreadActivity)
+	for _, msg := range messages {
+		threadID := messageThread(msg, roots)
+		thread := threads[threadID]
+		if thread == nil {
+			thread = &ThreadActivity{ThreadID: threadID}
+			threads[threadID] = thread
+		}
+		if msg.MessageID == threadID {
+			thread.Title = msg.Content()
+		}
+
+		thread.Count++
+		if msg.Status != model.MessageStatusPending && msg.Confidence >= g.minConfidence && msg.Label == 0 {
+			thread.UnproductiveMessages++
+		}
+	}
+
+	activity := make([]ThreadActivity, 0, len(threads))
+	for _, thread := range threads {
+		activity = append(activity, *thread)
+	}
+	sort.Slice(activity, func(i, j int) bool {
+		if activity[i].Count != activity[j].Count {
+			return activity[i].Count > activity[j].Count
+		}
+		return activity[i].ThreadID < activity[j].ThreadID
+	})
+	return activity
+}
+
+func formatThreads(locale string, threads []ThreadActivity) string {
+	if len(threads) == 0 {
+		return i18n.T(locale, "report.no_threads")
+	}
+	result := ""
+	for i, thread := range threads {
+		if i >= maxThreads {
+			result += i18n.T(locale, "report.more_threads", len(threads)-maxThreads) + "\n"
+			break
+		}
+		result += i18n.T(locale, "report.thread", threadName(locale, thread), thread.Count, thread.UnproductiveMessages) + "\n"
+	}
+	return result
+}
+
+// threadName is the ID to request a report of the thread with followed by its title.
+func threadName(locale string, thread ThreadActivity) string {
+	if thread.ThreadID == 0 {
+		return i18n.T(locale, "report.outside_threads")
+	}
+	name := fmt.Sprintf("#%d", thread.ThreadID)
+	if thread.Title != "" {
+		name += " " + escape(truncate(thread.Title, maxThreadTitleLength))
+	}
+	return name
+}
@@ -0,0 +1,115 @@
+package report
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+// Rolling baselines the report is compared against, in days before the report period
+const (
+	shortBaselineDays = 7
+	longBaselineDays  = 30
+)
+
+// Trend compares the report with an earlier period.
+type Trend struct {
+	Period                 Period  `json:"period"`
+	TotalMessages          int     `json:"totalMessages"`
+	DailyMessages          float64 `json:"dailyMessages"`
+	UnproductivePercentage float64 `json:"unproductivePercentage"`
+	// DailyMessagesDelta and UnproductivePercentageDelta are the report values minus the values of the period,
+	// the latter in percentage points
+	DailyMessagesDelta          float64 `json:"dailyMessagesDelta"`
+	UnproductivePercentageDelta float64 `json:"unproductivePercentageDelta"`
+}
+
+// historyPeriod covers the previous equivalent period and both baselines with a single query.
+func historyPeriod(period Period) Period {
+	from := period.From.AddDate(0, 0, -max(period.Days(), longBaselineDays))
+	return Period{From: from, To: period.From}
+}
+
+// comparisonPeriods returns the previous equivalent period and the rolling baselines.
+func comparisonPeriods(period Period) (previous, shortBaseline, longBaseline Period) {
+	previous = Period{From: period.From.AddDate(0, 0, -period.Days()), To: period.From}
+	shortBaseline = Period{From: period.From.AddDate(0, 0, -shortBaselineDays), To: period.From}
+	longBaseline = Period{From: period.From.AddDate(0, 0, -longBaselineDays), To: period.From}
+	return previous, shortBaseline, longBaseline
+}
+
+// newTrend returns nil when there is nothing to compare with in the period.
+func (g *ReportGenerator) newTrend(report *Report, history []*model.Message, period Period) *Trend {
+	total, productive, unproductive := 0, 0, 0
+	for _, msg := range history {
+		if msg.Date.Before(period.From) || !msg.Date.Before(period.To) {
+			continue
+		}
+		total++
+		if msg.Status == model.MessageStatusPending || msg.Confidence < g.minConfidence {
+			continue
+		}
+		if msg.Label == 1 {
+			productive++
+		} else if msg.Label == 0 {
+			unproductive++
+		}
+	}
+	if productive+unproductive == 0 {
+		return nil
+	}
+
+	trend := &Trend{
+		Period:                 period,
+		TotalMessages:          total,
+		DailyMessages:          float64(total) / float64(period.Days()),
+		UnproductivePercentage: float64(unproductive) / float64(productive+unproductive) * 100,
+	}
+	trend.DailyMessagesDelta = float64(report.TotalMessages)/float64(report.Period.Days()) - trend.DailyMessages
+	trend.UnproductivePercentageDelta = report.UnproductivePercentage - trend.UnproductivePercentage
+	return trend
+}
+
+func formatTrends(r *Report) string {
+	if r.PreviousPeriod == nil && r.ShortBaseline == nil && r.LongBaseline == nil {
+		return i18n.T(r.Locale, "report.no_trends")
+	}
+	result := ""
+	if r.PreviousPeriod != nil {
+		result += formatTrend(r.Locale, i18n.T(r.Locale, "report.trend_previous"), r.PreviousPeriod)
+	}
+	if r.ShortBaseline != nil {
+		result += formatTrend(r.Locale, i18n.T(r.Locale, "report.trend_baseline", shortBaselineDays), r.ShortBaseline)
+	}
+	if r.LongBaseline != nil {
+		result += formatTrend(r.Locale, i18n.T(r.Locale, "report.trend_baseline", longBaselineDays), r.LongBaseline)
+	}
+	return result
+}
+
+func formatTrend(locale, name string, trend *Trend) string {
+	return i18n.T(locale, "report.trend",
+		name,
+		trend.Period.Format(locale),
+		trend.UnproductivePercentage,
+		formatDelta(trend.UnproductivePercentageDelta, i18n.T(locale, "report.points")),
+		trend.DailyMessages,
+		formatDelta(trend.DailyMessagesDelta, "%+.1f"),
+	) + "\n"
+}
+
+// formatDelta shows the direction of the change, format is applied to the delta itself.
+func formatDelta(delta float64, format string) string {
+	arrow := "➡️"
+	switch {
+	case math.Abs(delta) < 0.005:
+		delta = 0
+	case delta > 0:
+		arrow = "⬆️"
+	default:
+		arrow = "⬇️"
+	}
+	return fmt.Sprintf("%s %s", arrow, fmt.Sprintf(format, delta))
+}
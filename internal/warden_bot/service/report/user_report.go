@@ -0,0 +1,136 @@
+package report
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+// UserReport describes the messages of one user across several chats.
+type UserReport struct {
+	Period                     Period             `json:"period"`
+	UserID                     int                `json:"userId"`
+	UserName                   string             `json:"userName"`
+	Chats                      []UserChatActivity `json:"chats"`
+	TotalMessages              int                `json:"totalMessages"`
+	ProductiveMessages         int                `json:"productiveMessages"`
+	UnproductiveMessages       int                `json:"unproductiveMessages"`
+	UnclassifiedMessages       int                `json:"unclassifiedMessages"`
+	LowConfidenceMessages      int                `json:"lowConfidenceMessages"`
+	ProductivePercentage       float64            `json:"productivePercentage"`
+	UnproductiveMessageSamples []string           `json:"unproductiveMessageSamples"`
+	Locale                     string             `json:"locale"`
+	// HourlyActivity counts the messages by the hour of day in the timezone of their chat
+	HourlyActivity [24]int `json:"hourlyActivity"`
+}
+
+type UserChatActivity struct {
+	ChatID               int64  `json:"chatId"`
+	ChatTitle            string `json:"chatTitle"`
+	TotalMessages        int    `json:"totalMessages"`
+	UnproductiveMessages int    `json:"unproductiveMessages"`
+}
+
+// GenerateUserReport builds the report of the user in the chats, days of the period start at midnight
+// in the timezone of each chat. Chats without messages of the user are left out.
+func (g *ReportGenerator) GenerateUserReport(ctx context.Context, user *model.User, chats []model.Chat, period Period, locale string) (*UserReport, error) {
+	report := &UserReport{
+		Period:                     period,
+		UserID:                     user.UserID,
+		UserName:                   user.DisplayName(),
+		Chats:                      []UserChatActivity{},
+		UnproductiveMessageSamples: []string{},
+		Locale:                     locale,
+	}
+
+	for _, chat := range chats {
+		settings, err := g.storage.GetChatSettings(ctx, chat.ChatID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch chat settings: %w", err)
+		}
+		loc := settings.Location()
+		bounds := period.In(loc)
+
+		messages, err := g.storage.GetMessagesByUserAndPeriod(ctx, user.UserID, chat.ChatID, bounds.From, bounds.To)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch messages: %w", err)
+		}
+		if len(messages) == 0 {
+			continue
+		}
+
+		activity := UserChatActivity{ChatID: chat.ChatID, ChatTitle: chat.Title, TotalMessages: len(messages)}
+		for _, msg := range messages {
+			report.TotalMessages++
+			report.HourlyActivity[msg.Date.In(loc).Hour()]++
+
+			switch {
+			case msg.Status == model.MessageStatusPending:
+				report.UnclassifiedMessages++
+			case msg.Confidence < g.minConfidence:
+				report.LowConfidenceMessages++
+			case msg.Label == 1:
+				report.ProductiveMessages++
+			case msg.Label == 0:
+				report.UnproductiveMessages++
+				activity.UnproductiveMessages++
+				report.UnproductiveMessageSamples = append(report.UnproductiveMessageSamples, msg.Content())
+			}
+		}
+		report.Chats = append(report.Chats, activity)
+	}
+
+	if report.TotalMessages == 0 {
+		return nil, ErrNoMessages
+	}
+
+	if classifiedMessages := report.ProductiveMessages + report.UnproductiveMessages; classifiedMessages > 0 {
+		report.ProductivePercentage = float64(report.ProductiveMessages) / float64(classifiedMessages) * 100
+	}
+	return report, nil
+}
+
+// String renders the report as Telegram HTML, user content is escaped. Use Pages to send it.
+func (r *UserReport) String() string {
+	return i18n.T(r.Locale, "user_report.text",
+		escape(r.UserName),
+		r.Period.Format(r.Locale),
+		r.TotalMessages,
+		r.ProductiveMessages,
+		r.UnproductiveMessages,
+		r.UnclassifiedMessages,
+		r.LowConfidenceMessages,
+		r.ProductivePercentage,
+		formatUserChats(r.Locale, r.Chats),
+		formatHourlyActivity(r.Locale, r.HourlyActivity),
+		formatExamples(r.Locale, r.UnproductiveMessageSamples, model.DefaultSampleLimit),
+	)
+}
+
+// Pages splits the report into messages that fit into the Telegram limit.
+func (r *UserReport) Pages() []string {
+	return paginate(r.String(), MaxMessageLength)
+}
+
+func formatUserChats(locale string, chats []UserChatActivity) string {
+	result := ""
+	for _, chat := range chats {
+		result += i18n.T(locale, "user_report.chat", escape(chat.ChatTitle), chat.TotalMessages, chat.UnproductiveMessages) + "\n"
+	}
+	return result
+}
+
+func formatHourlyActivity(locale string, hours [24]int) string {
+	result := ""
+	for hour, count := range hours {
+		if count > 0 {
+			result += i18n.T(locale, "report.count", fmt.Sprintf("%02d:00", hour), count) + "\n"
+		}
+	}
+	if result == "" {
+		return i18n.T(locale, "report.no_timeline")
+	}
+	return result
+}
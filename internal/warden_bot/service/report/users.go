@@ -0,0 +1,47 @@
+package report
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+)
+
+// userKey identifies the author of a message, messages saved without a user ID are grouped by the name.
+type userKey struct {
+	id   int
+	name string
+}
+
+func messageUser(msg *model.Message) userKey {
+	if msg.UserID != 0 {
+		return userKey{id: msg.UserID}
+	}
+	return userKey{name: msg.UserFullName}
+}
+
+// userNames returns the current display names of the authors. Users without a saved profile get the name
+// of their latest message, the messages are expected in chronological order.
+func (g *ReportGenerator) userNames(ctx context.Context, messages []*model.Message) (map[userKey]string, error) {
+	names := make(map[userKey]string)
+	ids := make([]int, 0)
+	for _, msg := range messages {
+		key := messageUser(msg)
+		if _, ok := names[key]; !ok && key.id != 0 {
+			ids = append(ids, key.id)
+		}
+		names[key] = msg.UserFullName
+	}
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	users, err := g.storage.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	for _, user := range users {
+		names[userKey{id: user.UserID}] = user.DisplayName()
+	}
+	return names, nil
+}
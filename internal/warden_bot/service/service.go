@@ -1,17 +1,22 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
-	"math"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/callback"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/classifier"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service/report"
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service/state"
@@ -19,102 +24,235 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
+// updateAttempts bounds the attempts to handle an update before it is skipped
+const updateAttempts = 3
+
+const defaultUpdateRetryDelay = time.Second
+
 type TelegramBotAPI interface {
 	GetUpdatesChan(u tgbotapi.UpdateConfig) (tgbotapi.UpdatesChannel, error)
 	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
 	GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbotapi.ChatMember, error)
+	AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
 }
 
 type WardenBotService struct {
 	tgBot           TelegramBotAPI
 	storage         storage.Storage
-	modelServiceUrl string
-	botState        *state.BotState
+	classifier      classifier.Classifier
+	botState        state.Store
 	reportGenerator *report.ReportGenerator
+	signer          *callback.Signer
+	webhook         *WebhookConfig
+	botID           int
+	batchSize       int
+	concurrency     int
+	// updateRetryDelay is the pause between attempts to handle a failed update
+	updateRetryDelay time.Duration
+}
+
+type Config struct {
+	// Webhook is nil when updates are received via long polling
+	Webhook *WebhookConfig
+	// BatchSize limits the number of messages in one classification request, 0 means no limit
+	BatchSize int
+	// Concurrency limits the number of parallel classification requests per chat
+	Concurrency int
+	// MinConfidence is the confidence below which reports flag predictions as uncertain
+	MinConfidence float64
+	// CallbackSecret signs inline keyboard callback data
+	CallbackSecret string
+	// State keeps pending dialogs, nil means an in-memory store with the default TTL
+	State state.Store
+	// BotID is the user ID of the bot, it tells the removal of the bot from a chat
+	BotID int
 }
 
-func NewWardenBotService(modelServiceUrl string, bot TelegramBotAPI, storage storage.Storage) *WardenBotService {
+func NewWardenBotService(classifier classifier.Classifier, bot TelegramBotAPI, storage storage.Storage, cfg Config) *WardenBotService {
+	botState := cfg.State
+	if botState == nil {
+		botState = state.NewBotState(state.DefaultTTL)
+	}
+
 	return &WardenBotService{
-		tgBot:           bot,
-		storage:         storage,
-		modelServiceUrl: modelServiceUrl,
-		botState:        state.NewBotState(),
-		reportGenerator: report.NewReportGenerator(storage),
+		tgBot:            bot,
+		storage:          storage,
+		classifier:       classifier,
+		webhook:          cfg.Webhook,
+		botID:            cfg.BotID,
+		batchSize:        cfg.BatchSize,
+		concurrency:      cfg.Concurrency,
+		botState:         botState,
+		reportGenerator:  report.NewReportGenerator(storage, cfg.MinConfidence),
+		signer:           callback.NewSigner(cfg.CallbackSecret),
+		updateRetryDelay: defaultUpdateRetryDelay,
 	}
 }
 
+// ProcessUpdatesFromBot resumes from the last committed update. The offset is committed only after an update
+// has been handled, transient errors are retried, and an update that keeps failing stops processing without
+// being committed, so it is requested again from the committed offset on the next start.
 func (s *WardenBotService) ProcessUpdatesFromBot(ctx context.Context) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	offset, err := s.storage.GetUpdateOffset(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch update offset: %w", err)
+	}
 
-	updates, err := s.tgBot.GetUpdatesChan(u)
+	updates, err := s.getUpdatesChan(ctx, offset+1)
 	if err != nil {
 		return err
 	}
 
-	for update := range updates {
-		if update.Message != nil {
-			s.storage.SaveChatInfo(ctx, &model.Chat{
-				ChatID: uint64(math.Abs(float64(update.Message.Chat.ID))),
-				Title:  update.Message.Chat.Title,
-				Type:   update.Message.Chat.Type,
-			})
-			if update.Message.Chat.IsGroup() || update.Message.Chat.IsSuperGroup() {
-				msg := &model.Message{
-					MessageID:    uint64(update.Message.MessageID),
-					UserFullName: fmt.Sprintf("%s %s", update.Message.From.FirstName, update.Message.From.LastName),
-					Text:         strings.ReplaceAll(update.Message.Text, "\n", " "),
-					Date:         time.Unix(int64(update.Message.Date), 0),
-					Label:        0,
-					ChatID:       uint64(math.Abs(float64(update.Message.Chat.ID))),
-				}
-
-				err := s.SaveMessage(ctx, msg)
-				if err != nil {
-					log.Printf("Failed to save message to database: %v", err)
-				}
-			} else if update.Message.Chat.IsPrivate() {
-
-				userID := update.Message.From.ID
-
-				switch update.Message.Command() {
-				case "report":
-					s.processReportCommand(ctx, update.Message, userID)
-				case "help":
-					s.processHelpCommand(ctx, update.Message.Chat.ID)
-				default:
-					currentState, exists := s.botState.GetUserState(userID)
-
-					if exists {
-						selectedText := update.Message.Text
-
-						var chatID uint64
-						_, err := fmt.Sscanf(selectedText, "%d:", &chatID)
-						if err != nil {
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Неправильный выбор. Попробуйте снова.")
-							s.tgBot.Send(msg)
-							continue
-						}
-
-						s.botState.ClearUserState(userID)
-
-						report, err := s.reportGenerator.GenerateReport(ctx, chatID, currentState)
-						if err != nil {
-							log.Printf("Failed to generate report: %v", err)
-							msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("%s %s", "Произошла ошибка при генерации отчета.", err.Error()))
-							s.tgBot.Send(msg)
-							continue
-						}
-
-						reportMsg := report.String()
-						chatId := update.Message.Chat.ID
-
-						msg := tgbotapi.NewMessage(chatId, reportMsg)
-						msg.ParseMode = "Markdown"
-						msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-						s.tgBot.Send(msg)
-					}
-				}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if update.UpdateID <= offset {
+				continue
+			}
+
+			if err := s.retryUpdate(ctx, update); err != nil {
+				return fmt.Errorf("failed to process update %d: %w", update.UpdateID, err)
+			}
+
+			if err := s.storage.SaveUpdateOffset(ctx, update.UpdateID); err != nil {
+				return err
+			}
+			offset = update.UpdateID
+		}
+	}
+}
+
+// retryUpdate handles the update up to updateAttempts times to ride out transient storage errors.
+func (s *WardenBotService) retryUpdate(ctx context.Context, update tgbotapi.Update) error {
+	var err error
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		if err = s.handleUpdate(ctx, update); err == nil {
+			return nil
+		}
+		if attempt == updateAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(s.updateRetryDelay):
+		}
+	}
+	return err
+}
+
+func (s *WardenBotService) getUpdatesChan(ctx context.Context, offset int) (tgbotapi.UpdatesChannel, error) {
+	if s.webhook == nil {
+		u := tgbotapi.NewUpdate(offset)
+		u.Timeout = 60
+
+		return s.tgBot.GetUpdatesChan(u)
+	}
+
+	handler := NewWebhookHandler(s.webhook.Secret, 100)
+	mux := http.NewServeMux()
+	mux.Handle(s.webhook.Path, handler)
+
+	listener, err := net.Listen("tcp", s.webhook.HttpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.webhook.HttpAddr, err)
+	}
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("webhook server stopped", slog.String("error", err.Error()))
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Listening for webhook updates", slog.String("addr", s.webhook.HttpAddr), slog.String("path", s.webhook.Path))
+	return handler.Updates(), nil
+}
+
+func (s *WardenBotService) handleUpdate(ctx context.Context, update tgbotapi.Update) error {
+	if update.CallbackQuery != nil {
+		s.handleCallbackQuery(ctx, update.CallbackQuery)
+		return nil
+	}
+
+	if update.EditedMessage != nil {
+		return s.handleEditedMessage(ctx, update.EditedMessage)
+	}
+
+	if update.Message == nil {
+		return nil
+	}
+
+	s.storage.SaveChatInfo(ctx, &model.Chat{
+		ChatID: update.Message.Chat.ID,
+		Title:  update.Message.Chat.Title,
+		Type:   update.Message.Chat.Type,
+		Active: true,
+	})
+	if update.Message.Chat.IsGroup() || update.Message.Chat.IsSuperGroup() {
+		if isEvent, err := s.handleChatEvent(ctx, update.Message); isEvent || err != nil {
+			return err
+		}
+
+		from := update.Message.From
+		fullName := fmt.Sprintf("%s %s", from.FirstName, from.LastName)
+		// The profile is refreshed with every message, so reports show the current name
+		err := s.storage.SaveUser(ctx, &model.User{
+			UserID:    from.ID,
+			Username:  from.UserName,
+			FullName:  fullName,
+			UpdatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		msg := newMessage(update.Message, fullName)
+		if err := s.resolveThread(ctx, msg); err != nil {
+			return err
+		}
+		return s.SaveMessage(ctx, msg)
+	} else if update.Message.Chat.IsPrivate() {
+
+		userID := update.Message.From.ID
+		locale := s.userLocale(ctx, update.Message.From)
+
+		switch update.Message.Command() {
+		case "report":
+			s.processReportCommand(ctx, update.Message, userID, locale)
+		case "export":
+			s.processExportCommand(ctx, update.Message, userID, locale)
+		case "subscribe":
+			s.processSubscribeCommand(ctx, update.Message, userID, locale)
+		case "unsubscribe":
+			s.processUnsubscribeCommand(ctx, update.Message, userID, locale)
+		case "help":
+			s.processHelpCommand(ctx, update.Message.Chat.ID, locale)
+		case "settings":
+			s.processSettingsCommand(ctx, update.Message, userID, locale)
+		case "language":
+			s.processLanguageCommand(ctx, update.Message, userID, locale)
+		case "userreport":
+			s.processUserReportCommand(ctx, update.Message, locale)
+		default:
+			conversation, exists, _ := s.botState.GetUserState(ctx, userID)
+			if exists && conversation.Step == state.StepEditSettings {
+				s.processSettingsInput(ctx, update.Message, userID, conversation.ChatID, locale)
+			} else if exists {
+				msg := tgbotapi.NewMessage(update.Message.Chat.ID, i18n.T(locale, "dialog.use_buttons"))
+				s.tgBot.Send(msg)
 			}
 		}
 	}
@@ -122,56 +260,298 @@ func (s *WardenBotService) ProcessUpdatesFromBot(ctx context.Context) error {
 	return nil
 }
 
-func (s *WardenBotService) processHelpCommand(ctx context.Context, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Доступные команды:\n\n"+
-		"/report [YYYY-MM-DD] - создать отчет (по умолчанию за предыдущий день)\n"+
-		"/help - помощь\n"+
-		"Contact: @nit3bo1")
+// handleEditedMessage keeps the previous text and caption of a group message in its history and reclassifies the new ones.
+func (s *WardenBotService) handleEditedMessage(ctx context.Context, message *tgbotapi.Message) error {
+	if !message.Chat.IsGroup() && !message.Chat.IsSuperGroup() {
+		return nil
+	}
+
+	return s.storage.EditMessage(ctx,
+		message.Chat.ID,
+		uint64(message.MessageID),
+		singleLine(message.Text),
+		singleLine(message.Caption),
+		time.Unix(int64(message.EditDate), 0).UTC(),
+	)
+}
+
+func (s *WardenBotService) handleCallbackQuery(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.Data == callbackNoop || query.Message == nil {
+		s.tgBot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	userID := query.From.ID
+	locale := s.userLocale(ctx, query.From)
+	action, args, err := s.signer.Verify(userID, query.Data)
+	if err != nil || len(args) == 0 {
+		log.Printf("Rejected callback query from user %d: %v", userID, err)
+		s.tgBot.AnswerCallbackQuery(tgbotapi.NewCallbackWithAlert(query.ID, i18n.T(locale, "callback.expired")))
+		return
+	}
+	s.tgBot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+
+	privateChatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+
+	// Choosing a language is not about a chat
+	if action == callbackLanguage {
+		s.setLanguage(ctx, privateChatID, messageID, userID, locale, args[0])
+		return
+	}
+
+	chatID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		log.Printf("Failed to parse chat ID from callback data %q: %v", query.Data, err)
+		return
+	}
+
+	switch action {
+	case callbackChat:
+		conversation, exists, err := s.botState.GetUserState(ctx, userID)
+		if err != nil {
+			log.Printf("Failed to get state of user %d: %v", userID, err)
+		}
+		format, threadID := "", uint64(0)
+		if exists {
+			format, threadID = conversation.Format, conversation.ThreadID
+		}
+		now := time.Now().In(s.chatLocation(ctx, chatID))
+		if exists && conversation.Period != "" {
+			s.clearUserState(ctx, userID)
+			// The period was validated with the command, relative periods count from today in the chat
+			period, err := report.ParsePeriod(conversation.Period, now)
+			if err != nil {
+				log.Printf("Failed to parse period %q of user %d: %v", conversation.Period, userID, err)
+				return
+			}
+			s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "report.generating", period.Format(locale))))
+			s.sendReport(ctx, privateChatID, userID, chatID, threadID, period, format, locale)
+			return
+		}
+
+		err = s.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepSelectDate, ChatID: chatID, Format: format, ThreadID: threadID})
+		if err != nil {
+			log.Printf("Failed to save state of user %d: %v", userID, err)
+		}
+
+		edit := tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "report.select_date"))
+		keyboard := s.calendarKeyboard(userID, chatID, now, now, locale)
+		edit.ReplyMarkup = &keyboard
+		s.tgBot.Send(edit)
+	case callbackMonth:
+		if len(args) < 2 {
+			return
+		}
+		month, err := time.Parse(monthLayout, args[1])
+		if err != nil {
+			log.Printf("Failed to parse month from callback data %q: %v", query.Data, err)
+			return
+		}
+
+		s.tgBot.Send(tgbotapi.NewEditMessageReplyMarkup(privateChatID, messageID, s.calendarKeyboard(userID, chatID, month, time.Now().In(s.chatLocation(ctx, chatID)), locale)))
+	case callbackDay:
+		if len(args) < 2 {
+			return
+		}
+		reportDate, err := time.Parse(time.DateOnly, args[1])
+		if err != nil {
+			log.Printf("Failed to parse date from callback data %q: %v", query.Data, err)
+			return
+		}
+
+		format, threadID := "", uint64(0)
+		if conversation, exists, _ := s.botState.GetUserState(ctx, userID); exists {
+			format, threadID = conversation.Format, conversation.ThreadID
+		}
+
+		s.clearUserState(ctx, userID)
+		period := report.DayPeriod(reportDate)
+		s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "report.generating", period.Format(locale))))
+		s.sendReport(ctx, privateChatID, userID, chatID, threadID, period, format, locale)
+	case callbackSubscribe:
+		s.subscribe(ctx, privateChatID, messageID, userID, chatID, args[1:], locale)
+	case callbackUnsubscribe:
+		s.unsubscribe(ctx, privateChatID, messageID, userID, chatID, locale)
+	case callbackSettings:
+		s.editSettings(ctx, privateChatID, messageID, userID, chatID, locale)
+	}
+}
+
+// chatLocation returns the timezone of the chat, UTC when the settings are unavailable.
+func (s *WardenBotService) chatLocation(ctx context.Context, chatID int64) *time.Location {
+	settings, err := s.storage.GetChatSettings(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get settings of chat %d: %v", chatID, err)
+		return time.UTC
+	}
+	return settings.Location()
+}
+
+func (s *WardenBotService) clearUserState(ctx context.Context, userID int) {
+	if err := s.botState.ClearUserState(ctx, userID); err != nil {
+		log.Printf("Failed to clear state of user %d: %v", userID, err)
+	}
+}
+
+// sendReport re-checks admin rights because a signed button may outlive them. A non-empty format sends
+// an export document of the whole chat instead of the text report, a non-zero threadID limits the text report to the thread.
+func (s *WardenBotService) sendReport(ctx context.Context, privateChatID int64, userID int, chatID int64, threadID uint64, period report.Period, format, locale string) {
+	isAdmin, err := s.isChatAdmin(chatID, userID)
+	if err != nil {
+		log.Printf("Failed to fetch administrators for chat %d: %v", chatID, err)
+		s.tgBot.Send(tgbotapi.NewMessage(privateChatID, i18n.T(locale, "error.admin_chats")))
+		return
+	}
+	if !isAdmin {
+		s.tgBot.Send(tgbotapi.NewMessage(privateChatID, i18n.T(locale, "error.not_admin")))
+		return
+	}
+
+	if format != "" {
+		s.sendExport(ctx, privateChatID, chatID, period, format, locale)
+		return
+	}
+
+	chatReport, err := s.reportGenerator.GenerateThreadReport(ctx, chatID, threadID, period, locale)
+	if err != nil {
+		log.Printf("Failed to generate report: %v", err)
+		s.tgBot.Send(tgbotapi.NewMessage(privateChatID, reportErrorText(locale, "report.error", err)))
+		return
+	}
+
+	if err := s.sendReportPages(privateChatID, chatReport.Pages()); err != nil {
+		log.Printf("Failed to send report for chat %d: %v", chatID, err)
+		s.tgBot.Send(tgbotapi.NewMessage(privateChatID, i18n.T(locale, "report.send_failed")))
+		return
+	}
+	s.sendChart(privateChatID, chatReport)
+}
+
+// sendReportPages sends the pages of a report in order and stops at the first failed page.
+func (s *WardenBotService) sendReportPages(privateChatID int64, pages []string) error {
+	for i, page := range pages {
+		msg := tgbotapi.NewMessage(privateChatID, page)
+		msg.ParseMode = report.ParseMode
+		if _, err := s.tgBot.Send(msg); err != nil {
+			return fmt.Errorf("failed to send page %d of %d: %w", i+1, len(pages), err)
+		}
+	}
+	return nil
+}
+
+// sendChart follows the text report, a chart that failed to render or send is only logged.
+func (s *WardenBotService) sendChart(privateChatID int64, chatReport *report.Report) {
+	chart, err := report.RenderChart(chatReport)
+	if err != nil {
+		log.Printf("Failed to render chart: %v", err)
+		return
+	}
+
+	photo := tgbotapi.NewPhotoUpload(privateChatID, tgbotapi.FileBytes{Name: "chart.png", Bytes: chart})
+	photo.Caption = i18n.T(chatReport.Locale, "report.chart_caption")
+	if _, err := s.tgBot.Send(photo); err != nil {
+		log.Printf("Failed to send chart: %v", err)
+	}
+}
+
+func (s *WardenBotService) sendExport(ctx context.Context, privateChatID int64, chatID int64, period report.Period, format, locale string) {
+	name, data, err := s.reportGenerator.Export(ctx, chatID, period, format, locale)
+	if err != nil {
+		log.Printf("Failed to export report: %v", err)
+		s.tgBot.Send(tgbotapi.NewMessage(privateChatID, reportErrorText(locale, "export.error", err)))
+		return
+	}
+
+	if _, err := s.tgBot.Send(tgbotapi.NewDocumentUpload(privateChatID, tgbotapi.FileBytes{Name: name, Bytes: data})); err != nil {
+		log.Printf("Failed to send export %s: %v", name, err)
+	}
+}
+
+// reportErrorText shows a missing data error as is and prefixes other errors with the message of key.
+func reportErrorText(locale, key string, err error) string {
+	if errors.Is(err, report.ErrNoMessages) {
+		return i18n.T(locale, "report.no_messages")
+	}
+	return i18n.T(locale, key, err.Error())
+}
+
+func (s *WardenBotService) processHelpCommand(ctx context.Context, chatID int64, locale string) {
+	msg := tgbotapi.NewMessage(chatID, i18n.T(locale, "help"))
 	s.tgBot.Send(msg)
 }
 
-func (s *WardenBotService) processReportCommand(ctx context.Context, message *tgbotapi.Message, userID int) {
+// processReportCommand handles "/report [period] [#thread]" with the arguments in any order.
+func (s *WardenBotService) processReportCommand(ctx context.Context, message *tgbotapi.Message, userID int, locale string) {
+	periodArg, threadID := "", uint64(0)
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		if !strings.HasPrefix(arg, "#") {
+			periodArg = arg
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(arg, "#"), 10, 64)
+		if err != nil || id == 0 {
+			s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "report.invalid_thread")))
+			return
+		}
+		threadID = id
+	}
+	s.startReportDialog(ctx, message, userID, periodArg, threadID, "", locale)
+}
+
+func (s *WardenBotService) processExportCommand(ctx context.Context, message *tgbotapi.Message, userID int, locale string) {
+	args := strings.Fields(message.CommandArguments())
+
+	format := report.FormatJSON
+	if len(args) > 0 && slices.Contains(report.Formats, args[0]) {
+		format = args[0]
+		args = args[1:]
+	}
+
+	periodArg := ""
+	if len(args) > 0 {
+		periodArg = args[0]
+	}
+	s.startReportDialog(ctx, message, userID, periodArg, 0, format, locale)
+}
+
+// startReportDialog asks for the chat of a text report, or of an export when format is set.
+func (s *WardenBotService) startReportDialog(ctx context.Context, message *tgbotapi.Message, userID int, periodArg string, threadID uint64, format, locale string) {
 	adminChats, err := s.GetAdminChats(ctx, message.From.ID)
 	if err != nil {
 		log.Printf("Failed to get admin chats: %v", err)
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Произошла ошибка при получении списка чатов.")
+		msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.admin_chats"))
 		s.tgBot.Send(msg)
 		return
 	}
 
-	var buttons []tgbotapi.KeyboardButton
-	for _, chat := range adminChats {
-		buttons = append(buttons, tgbotapi.NewKeyboardButton(fmt.Sprintf("%d:%s", chat.ChatID, chat.Title)))
-	}
-
-	if len(buttons) == 0 {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Вы не являетесь администратором ни в одном групповом чате.")
+	if len(adminChats) == 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.no_admin_chats"))
 		s.tgBot.Send(msg)
 		return
 	}
 
-	commandArgs := strings.Split(message.CommandArguments(), " ")[0]
-
-	var reportDate time.Time
-
-	if commandArgs != "" {
-		reportDate, err = time.Parse("2006-01-02", commandArgs)
-		if err != nil {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Некорректный формат даты. Используйте формат YYYY-MM-DD.")
+	// Without a period in the arguments the date is picked in the calendar after the chat
+	if periodArg != "" {
+		if _, err := report.ParsePeriod(periodArg, time.Now()); err != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "report.invalid_period", report.MaxPeriodDays))
 			s.tgBot.Send(msg)
 			return
 		}
-	} else {
-		reportDate = time.Now().Truncate(24 * time.Hour)
 	}
 
-	s.botState.SetUserState(userID, reportDate)
-
-	keyboard := tgbotapi.NewReplyKeyboard(buttons)
-	keyboard.OneTimeKeyboard = true
+	err = s.botState.SetUserState(ctx, userID, &state.Conversation{
+		Step:     state.StepSelectChat,
+		Period:   periodArg,
+		Format:   format,
+		ThreadID: threadID,
+	})
+	if err != nil {
+		log.Printf("Failed to save state of user %d: %v", userID, err)
+	}
 
-	msg := tgbotapi.NewMessage(message.Chat.ID, "Выберите чат:")
-	msg.ReplyMarkup = keyboard
+	msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "report.select_chat"))
+	msg.ReplyMarkup = s.chatsKeyboard(userID, adminChats, callbackChat)
 	s.tgBot.Send(msg)
 }
 
@@ -183,14 +563,22 @@ func (s *WardenBotService) SaveMessage(ctx context.Context, msg *model.Message)
 	return nil
 }
 
+// ProcessMessages classifies messages of every group chat written after the chat's watermark and moves the
+// watermark forward, so a missed run is caught up by the next one and a repeated run does not reclassify anything.
 func (s *WardenBotService) ProcessMessages(ctx context.Context) error {
 	chats, err := s.storage.GetGroupChats(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to fetch chats: %w", err)
 	}
 
+	var errs []error
 	for _, chat := range chats {
-		messages, err := s.storage.GetMessagesForLastDayByChat(ctx, chat.ChatID)
+		watermark, err := s.storage.GetClassificationWatermark(ctx, chat.ChatID)
+		if err != nil {
+			return err
+		}
+
+		messages, err := s.storage.GetMessagesAfterWatermark(ctx, watermark)
 		if err != nil {
 			return err
 		}
@@ -199,74 +587,201 @@ func (s *WardenBotService) ProcessMessages(ctx context.Context) error {
 			continue
 		}
 
-		var messageRequests []model.MessageRequest
-		for _, msg := range messages {
-			messageRequests = append(messageRequests, model.MessageRequest{
-				Text:      msg.Text,
-				MessageID: msg.MessageID,
-				ChatID:    msg.ChatID,
-			})
+		classified, err := s.classifyChat(ctx, messages)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %d: %w", chat.ChatID, err))
 		}
 
-		messagesToUpdate, err := s.RequestToModel(ctx, messageRequests)
-		if err != nil {
-			slog.Error(err.Error())
+		if classified == 0 {
+			continue
+		}
+
+		// Telegram dates have one second resolution, so the watermark compares (date, message_id) like the query
+		last := messages[classified-1]
+		if !afterWatermark(last, watermark) {
 			continue
 		}
 
-		err = s.storage.UpdateMessages(ctx, messagesToUpdate)
+		watermark.ClassifiedUntil = last.Date
+		watermark.MessageID = last.MessageID
+		if err := s.storage.SaveClassificationWatermark(ctx, watermark); err != nil {
+			errs = append(errs, fmt.Errorf("chat %d: %w", chat.ChatID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// afterWatermark tells whether the message is ordered after the watermark by (date, message_id).
+func afterWatermark(msg model.Message, watermark *model.ClassificationWatermark) bool {
+	if !msg.Date.Equal(watermark.ClassifiedUntil) {
+		return msg.Date.After(watermark.ClassifiedUntil)
+	}
+	return msg.MessageID > watermark.MessageID
+}
+
+// Backfill reclassifies messages written in [from, to) regardless of their status. Zero chatID means all group chats.
+// Watermarks are left untouched.
+func (s *WardenBotService) Backfill(ctx context.Context, chatID int64, from, to time.Time) error {
+	chats := []model.Chat{{ChatID: chatID}}
+	if chatID == 0 {
+		var err error
+		chats, err = s.storage.GetGroupChats(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch chats: %w", err)
+		}
+	}
+
+	var errs []error
+	for _, chat := range chats {
+		messages, err := s.storage.GetMessagesByChatAndRange(ctx, chat.ChatID, from, to)
 		if err != nil {
 			return err
 		}
+
+		classified, err := s.classifyChat(ctx, messages)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %d: %w", chat.ChatID, err))
+		}
+		slog.Info("Backfill finished for chat",
+			slog.Int64("chat_id", chat.ChatID),
+			slog.Int("messages", len(messages)),
+			slog.Int("classified", classified),
+		)
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-func (s *WardenBotService) RequestToModel(ctx context.Context, messages []model.MessageRequest) ([]*model.Message, error) {
-	var messageRequests []model.MessageRequest
-	for _, msg := range messages {
-		messageRequests = append(messageRequests, model.MessageRequest{
-			Text:      msg.Text,
-			MessageID: msg.MessageID,
-			ChatID:    msg.ChatID,
-		})
+// classifyChat classifies messages in batches running at most s.concurrency requests at once.
+// Every batch is saved as soon as it is classified, so a failed batch does not discard the others.
+// It returns the number of leading messages that are classified without a gap.
+func (s *WardenBotService) classifyChat(ctx context.Context, messages []model.Message) (int, error) {
+	if len(messages) == 0 {
+		return 0, nil
 	}
 
-	requestBody := model.MessagesRequest{Messages: messageRequests}
-	requestJSON, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	batchSize := s.batchSize
+	if batchSize <= 0 {
+		batchSize = len(messages)
+	}
+	concurrency := s.concurrency
+	if concurrency <= 0 {
+		concurrency = 1
 	}
 
-	resp, err := http.Post(s.modelServiceUrl+"/classify", "application/json", bytes.NewBuffer(requestJSON))
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, concurrency)
+	done := make([]bool, (len(messages)+batchSize-1)/batchSize)
+
+	for start := 0; start < len(messages); start += batchSize {
+		batchIndex := start / batchSize
+		batch := make([]model.MessageRequest, 0, batchSize)
+		for _, msg := range messages[start:min(start+batchSize, len(messages))] {
+			batch = append(batch, model.MessageRequest{
+				Text:      msg.Content(),
+				MessageID: msg.MessageID,
+				ChatID:    msg.ChatID,
+			})
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ok, err := s.classifyBatch(ctx, batch)
+			mu.Lock()
+			defer mu.Unlock()
+			done[batchIndex] = ok
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	classified := 0
+	for i := 0; i < len(done) && done[i]; i++ {
+		classified = min((i+1)*batchSize, len(messages))
+	}
+	return classified, errors.Join(errs...)
+}
+
+// classifyBatch reports whether the batch is classified and saved. Classifier failures are only logged,
+// the batch stays pending and is retried on the next run.
+func (s *WardenBotService) classifyBatch(ctx context.Context, batch []model.MessageRequest) (bool, error) {
+	messagesToUpdate, err := s.classifyMessages(ctx, batch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send classification request: %w", err)
+		slog.Error(err.Error())
+		return false, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("classification API returned non-200 status: %s", resp.Status)
+	if err := s.storage.UpdateMessages(ctx, messagesToUpdate); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	var classifiedResponse model.ClassifiedMessagesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&classifiedResponse); err != nil {
-		return nil, fmt.Errorf("failed to decode classification response: %w", err)
+func (s *WardenBotService) classifyMessages(ctx context.Context, messages []model.MessageRequest) ([]*model.Message, error) {
+	classifiedMessages, err := s.classifier.Classify(ctx, messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to classify messages: %w", err)
 	}
 
-	messagesToUpdate := make([]*model.Message, 0, len(classifiedResponse.Messages))
-	for _, message := range classifiedResponse.Messages {
-		fmt.Printf("%+v", message)
+	messagesToUpdate := make([]*model.Message, 0, len(classifiedMessages))
+	for _, message := range classifiedMessages {
+		category := message.Category
+		if category == "" {
+			category = model.CategoryForLabel(message.Label)
+		}
+		confidence := 1.0
+		if message.Confidence != nil {
+			confidence = *message.Confidence
+		}
+
 		messagesToUpdate = append(messagesToUpdate, &model.Message{
-			MessageID: message.MessageID,
-			Label:     message.Label,
-			ChatID:    message.ChatID,
+			MessageID:  message.MessageID,
+			Label:      model.LabelForCategory(category),
+			Category:   category,
+			Confidence: confidence,
+			ChatID:     message.ChatID,
 		})
 	}
 
 	return messagesToUpdate, nil
 }
 
+func (s *WardenBotService) isChatAdmin(chatID int64, userID int) (bool, error) {
+	chatAdmins, err := s.tgBot.GetChatAdministrators(tgbotapi.ChatConfig{ChatID: chatID})
+	if err != nil {
+		return false, err
+	}
+
+	for _, admin := range chatAdmins {
+		if admin.User.ID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (s *WardenBotService) GetAdminChats(ctx context.Context, userID int) ([]model.Chat, error) {
 	groupChats, err := s.storage.GetGroupChats(ctx)
 	if err != nil {
@@ -276,17 +791,14 @@ func (s *WardenBotService) GetAdminChats(ctx context.Context, userID int) ([]mod
 	adminChats := make([]model.Chat, 0)
 
 	for _, chat := range groupChats {
-		chatAdmins, err := s.tgBot.GetChatAdministrators(tgbotapi.ChatConfig{ChatID: -int64(chat.ChatID)})
+		isAdmin, err := s.isChatAdmin(chat.ChatID, userID)
 		if err != nil {
 			log.Printf("Failed to fetch administrators for chat %d: %v", chat.ChatID, err)
 			continue
 		}
 
-		for _, admin := range chatAdmins {
-			if admin.User.ID == userID {
-				adminChats = append(adminChats, chat)
-				break
-			}
+		if isAdmin {
+			adminChats = append(adminChats, chat)
 		}
 	}
 
@@ -4,13 +4,20 @@ import (
 	"context"
 	"errors"
 	"github.com/g3ksa/warden_bot/mocks/bot"
+	"github.com/g3ksa/warden_bot/mocks/classifier"
 	"github.com/g3ksa/warden_bot/mocks/storage"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/callback"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/report"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/state"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestSaveMessage(t *testing.T) {
@@ -21,7 +28,7 @@ func TestSaveMessage(t *testing.T) {
 		Text:         "Hello, World!",
 		Date:         time.Now(),
 		Label:        0,
-		ChatID:       123,
+		ChatID:       -123,
 	}
 
 	t.Run("Success", func(t *testing.T) {
@@ -54,8 +61,8 @@ func TestGetAdminChats(t *testing.T) {
 		mockStorage, mockTgBot, wardenBotService := setupTest()
 
 		groupChats := []model.Chat{
-			{ChatID: 1, Title: "Chat 1", Type: "group"},
-			{ChatID: 2, Title: "Chat 2", Type: "supergroup"},
+			{ChatID: -1, Title: "Chat 1", Type: "group"},
+			{ChatID: -2, Title: "Chat 2", Type: "supergroup"},
 		}
 
 		chatAdmins := []tgbotapi.ChatMember{
@@ -69,7 +76,7 @@ func TestGetAdminChats(t *testing.T) {
 		adminChats, err := wardenBotService.GetAdminChats(ctx, userID)
 		assert.NoError(t, err)
 		assert.Equal(t, 1, len(adminChats))
-		assert.Equal(t, uint64(1), adminChats[0].ChatID)
+		assert.Equal(t, int64(-1), adminChats[0].ChatID)
 
 		mockStorage.AssertExpectations(t)
 		mockTgBot.AssertExpectations(t)
@@ -92,7 +99,7 @@ func TestGetAdminChats(t *testing.T) {
 		mockStorage, mockTgBot, wardenBotService := setupTest()
 
 		groupChats := []model.Chat{
-			{ChatID: 1, Title: "Chat 1", Type: "group"},
+			{ChatID: -1, Title: "Chat 1", Type: "group"},
 		}
 
 		mockStorage.On("GetGroupChats", ctx).Return(groupChats, nil)
@@ -115,7 +122,7 @@ func TestClassifyMessages(t *testing.T) {
 		Text:         "Hello, World!",
 		Date:         time.Now(),
 		Label:        0,
-		ChatID:       123,
+		ChatID:       -123,
 	}
 
 	t.Run("Big messages", func(t *testing.T) {
@@ -137,12 +144,591 @@ func TestClassifyMessages(t *testing.T) {
 	})
 }
 
+func TestProcessUpdatesFromBot(t *testing.T) {
+	ctx := context.Background()
+
+	groupUpdate := func(updateID, messageID int) tgbotapi.Update {
+		return tgbotapi.Update{
+			UpdateID: updateID,
+			Message: &tgbotapi.Message{
+				MessageID: messageID,
+				From:      &tgbotapi.User{ID: 7, FirstName: "John", LastName: "Doe"},
+				Chat:      &tgbotapi.Chat{ID: -123, Type: "group", Title: "Chat"},
+				Date:      1733050000,
+				Text:      "Hello, World!",
+			},
+		}
+	}
+
+	updatesChan := func(updates ...tgbotapi.Update) tgbotapi.UpdatesChannel {
+		ch := make(chan tgbotapi.Update, len(updates))
+		for _, update := range updates {
+			ch <- update
+		}
+		close(ch)
+		return ch
+	}
+
+	t.Run("Commits offset after save", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetUpdateOffset", ctx).Return(10, nil)
+		mockTgBot.On("GetUpdatesChan", mock.MatchedBy(func(u tgbotapi.UpdateConfig) bool {
+			return u.Offset == 11
+		})).Return(updatesChan(groupUpdate(10, 1), groupUpdate(11, 2)), nil)
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveUser", ctx, mock.MatchedBy(func(u *model.User) bool {
+			return u.UserID == 7 && u.FullName == "John Doe"
+		})).Return(nil)
+		mockStorage.On("PutMessage", ctx, mock.MatchedBy(func(m *model.Message) bool {
+			return m.UserID == 7 && m.UserFullName == "John Doe"
+		})).Return(nil)
+		mockStorage.On("SaveUpdateOffset", ctx, 11).Return(nil)
+
+		err := wardenBotService.ProcessUpdatesFromBot(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertNumberOfCalls(t, "PutMessage", 1)
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+	})
+
+	t.Run("Keeps offset when update keeps failing", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetUpdateOffset", ctx).Return(0, nil)
+		mockTgBot.On("GetUpdatesChan", mock.Anything).Return(updatesChan(groupUpdate(1, 1), groupUpdate(2, 2)), nil)
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveUser", ctx, mock.Anything).Return(nil)
+		mockStorage.On("PutMessage", ctx, mock.Anything).Return(errors.New("database error"))
+
+		err := wardenBotService.ProcessUpdatesFromBot(ctx)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to process update 1")
+
+		mockStorage.AssertNotCalled(t, "SaveUpdateOffset", ctx, mock.Anything)
+		mockStorage.AssertNumberOfCalls(t, "PutMessage", updateAttempts)
+	})
+
+	t.Run("Retries transient error", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetUpdateOffset", ctx).Return(0, nil)
+		mockTgBot.On("GetUpdatesChan", mock.Anything).Return(updatesChan(groupUpdate(1, 1)), nil)
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveUser", ctx, mock.Anything).Return(nil)
+		mockStorage.On("PutMessage", ctx, mock.Anything).Return(errors.New("database error")).Once()
+		mockStorage.On("PutMessage", ctx, mock.Anything).Return(nil).Once()
+		mockStorage.On("SaveUpdateOffset", ctx, 1).Return(nil)
+
+		err := wardenBotService.ProcessUpdatesFromBot(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertNumberOfCalls(t, "PutMessage", 2)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Media message", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		media := groupUpdate(1, 5)
+		media.Message.Text = ""
+		media.Message.Caption = "Look,\nhere"
+		media.Message.Photo = &[]tgbotapi.PhotoSize{{FileID: "photo"}}
+		media.Message.ReplyToMessage = &tgbotapi.Message{MessageID: 4}
+		media.Message.ForwardFromChat = &tgbotapi.Chat{ID: -1001}
+
+		mockStorage.On("GetUpdateOffset", ctx).Return(0, nil)
+		mockTgBot.On("GetUpdatesChan", mock.Anything).Return(updatesChan(media), nil)
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveUser", ctx, mock.Anything).Return(nil)
+		mockStorage.On("GetMessageThreadID", ctx, int64(-123), uint64(4)).Return(uint64(2), nil)
+		mockStorage.On("PutMessage", ctx, mock.MatchedBy(func(m *model.Message) bool {
+			return m.ContentType == model.ContentTypePhoto && m.Text == "" && m.Caption == "Look, here" &&
+				m.ReplyToMessageID == 4 && m.ThreadID == 2 && m.ForwardFromChatID == -1001 && m.Content() == "Look, here"
+		})).Return(nil)
+		mockStorage.On("SaveUpdateOffset", ctx, 1).Return(nil)
+
+		err := wardenBotService.ProcessUpdatesFromBot(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Reply starts thread", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		reply := groupUpdate(1, 5)
+		reply.Message.ReplyToMessage = &tgbotapi.Message{MessageID: 4}
+
+		mockStorage.On("GetUpdateOffset", ctx).Return(0, nil)
+		mockTgBot.On("GetUpdatesChan", mock.Anything).Return(updatesChan(reply), nil)
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveUser", ctx, mock.Anything).Return(nil)
+		mockStorage.On("GetMessageThreadID", ctx, int64(-123), uint64(4)).Return(uint64(0), nil)
+		mockStorage.On("PutMessage", ctx, mock.MatchedBy(func(m *model.Message) bool {
+			return m.ThreadID == 4
+		})).Return(nil)
+		mockStorage.On("SaveUpdateOffset", ctx, 1).Return(nil)
+
+		err := wardenBotService.ProcessUpdatesFromBot(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Edited message", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		edited := groupUpdate(1, 5).Message
+		edited.Text = "Hello,\nedited"
+		edited.EditDate = 1733050060
+
+		mockStorage.On("GetUpdateOffset", ctx).Return(0, nil)
+		mockTgBot.On("GetUpdatesChan", mock.Anything).Return(updatesChan(tgbotapi.Update{UpdateID: 1, EditedMessage: edited}), nil)
+		mockStorage.On("EditMessage", ctx, int64(-123), uint64(5), "Hello, edited", "", time.Unix(1733050060, 0).UTC()).Return(nil)
+		mockStorage.On("SaveUpdateOffset", ctx, 1).Return(nil)
+
+		err := wardenBotService.ProcessUpdatesFromBot(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertNotCalled(t, "PutMessage", ctx, mock.Anything)
+		mockStorage.AssertExpectations(t)
+	})
+}
+
+func TestContentType(t *testing.T) {
+	t.Run("Text entities", func(t *testing.T) {
+		message := &tgbotapi.Message{
+			Text:     "@john see https://example.com and https://example.org",
+			Entities: &[]tgbotapi.MessageEntity{{Type: "mention"}, {Type: "url"}, {Type: "url"}},
+		}
+		assert.Equal(t, model.ContentTypeText, contentType(message))
+		assert.Equal(t, "mention,url", entityTypes(message))
+	})
+
+	t.Run("Animation before document", func(t *testing.T) {
+		message := &tgbotapi.Message{Animation: &tgbotapi.ChatAnimation{}, Document: &tgbotapi.Document{}}
+		assert.Equal(t, model.ContentTypeAnimation, contentType(message))
+	})
+
+	t.Run("Location", func(t *testing.T) {
+		assert.Equal(t, model.ContentTypeOther, contentType(&tgbotapi.Message{Location: &tgbotapi.Location{}}))
+	})
+}
+
+func TestProcessMessages(t *testing.T) {
+	ctx := context.Background()
+
+	date := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	chats := []model.Chat{{ChatID: -1, Title: "Chat 1", Type: "group"}}
+	messages := []model.Message{
+		{MessageID: 1, ChatID: -1, Text: "deploy is broken", Date: date},
+		{MessageID: 2, ChatID: -1, Text: "lunch?", Date: date.Add(time.Minute)},
+	}
+	requests := []model.MessageRequest{
+		{MessageID: 1, ChatID: -1, Text: "deploy is broken"},
+		{MessageID: 2, ChatID: -1, Text: "lunch?"},
+	}
+
+	setup := func() (*storage.MockStorage, *classifier.MockClassifier, *WardenBotService) {
+		mockStorage, _, wardenBotService := setupTest()
+		mockClassifier := new(classifier.MockClassifier)
+		wardenBotService.classifier = mockClassifier
+
+		watermark := &model.ClassificationWatermark{ChatID: -1}
+		mockStorage.On("GetGroupChats", ctx).Return(chats, nil)
+		mockStorage.On("GetClassificationWatermark", ctx, int64(-1)).Return(watermark, nil)
+		mockStorage.On("GetMessagesAfterWatermark", ctx, watermark).Return(messages, nil)
+		return mockStorage, mockClassifier, wardenBotService
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockStorage, mockClassifier, wardenBotService := setup()
+
+		mockClassifier.On("Classify", ctx, requests).Return([]model.ClassifiedMessage{
+			{MessageID: 1, ChatID: -1, Label: 1},
+			{MessageID: 2, ChatID: -1, Label: 0},
+		}, nil)
+		mockStorage.On("UpdateMessages", ctx, []*model.Message{
+			{MessageID: 1, ChatID: -1, Label: 1, Category: model.CategoryWork, Confidence: 1},
+			{MessageID: 2, ChatID: -1, Label: 0, Category: model.CategoryOffTopic, Confidence: 1},
+		}).Return(nil)
+		mockStorage.On("SaveClassificationWatermark", ctx, &model.ClassificationWatermark{
+			ChatID:          -1,
+			ClassifiedUntil: date.Add(time.Minute),
+			MessageID:       2,
+		}).Return(nil)
+
+		err := wardenBotService.ProcessMessages(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockClassifier.AssertExpectations(t)
+	})
+
+	t.Run("Classifier error", func(t *testing.T) {
+		mockStorage, mockClassifier, wardenBotService := setup()
+
+		mockClassifier.On("Classify", ctx, requests).Return([]model.ClassifiedMessage{}, errors.New("model service is down"))
+
+		err := wardenBotService.ProcessMessages(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertNotCalled(t, "UpdateMessages", ctx, mock.Anything)
+		mockStorage.AssertNotCalled(t, "SaveClassificationWatermark", ctx, mock.Anything)
+	})
+
+	t.Run("Batches", func(t *testing.T) {
+		mockStorage, mockClassifier, wardenBotService := setup()
+		wardenBotService.batchSize = 1
+		wardenBotService.concurrency = 2
+		confidence := 0.7
+
+		mockClassifier.On("Classify", ctx, requests[:1]).Return([]model.ClassifiedMessage{}, errors.New("model service is down"))
+		mockClassifier.On("Classify", ctx, requests[1:]).Return([]model.ClassifiedMessage{{MessageID: 2, ChatID: -1, Category: model.CategorySpam, Confidence: &confidence}}, nil)
+		mockStorage.On("UpdateMessages", ctx, []*model.Message{{MessageID: 2, ChatID: -1, Label: 0, Category: model.CategorySpam, Confidence: confidence}}).Return(nil)
+
+		err := wardenBotService.ProcessMessages(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertNumberOfCalls(t, "UpdateMessages", 1)
+		mockClassifier.AssertNumberOfCalls(t, "Classify", 2)
+		// The first message is still pending, so the watermark must not pass it
+		mockStorage.AssertNotCalled(t, "SaveClassificationWatermark", ctx, mock.Anything)
+	})
+
+	t.Run("Watermark stops at the first failed batch", func(t *testing.T) {
+		mockStorage, mockClassifier, wardenBotService := setup()
+		wardenBotService.batchSize = 1
+
+		mockClassifier.On("Classify", ctx, requests[:1]).Return([]model.ClassifiedMessage{{MessageID: 1, ChatID: -1, Label: 1}}, nil)
+		mockClassifier.On("Classify", ctx, requests[1:]).Return([]model.ClassifiedMessage{}, errors.New("model service is down"))
+		mockStorage.On("UpdateMessages", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveClassificationWatermark", ctx, &model.ClassificationWatermark{
+			ChatID:          -1,
+			ClassifiedUntil: date,
+			MessageID:       1,
+		}).Return(nil)
+
+		err := wardenBotService.ProcessMessages(ctx)
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Messages of the same second split across runs", func(t *testing.T) {
+		mockStorage, _, wardenBotService := setupTest()
+		mockClassifier := new(classifier.MockClassifier)
+		wardenBotService.classifier = mockClassifier
+		wardenBotService.batchSize = 1
+
+		sameSecond := []model.Message{
+			{MessageID: 1, ChatID: -1, Text: "deploy is broken", Date: date},
+			{MessageID: 2, ChatID: -1, Text: "lunch?", Date: date},
+		}
+		watermark := &model.ClassificationWatermark{ChatID: -1}
+		mockStorage.On("GetGroupChats", ctx).Return(chats, nil)
+		mockStorage.On("GetClassificationWatermark", ctx, int64(-1)).Return(watermark, nil)
+		mockStorage.On("GetMessagesAfterWatermark", ctx, watermark).Return(sameSecond, nil).Once()
+		mockClassifier.On("Classify", ctx, requests[:1]).Return([]model.ClassifiedMessage{{MessageID: 1, ChatID: -1, Label: 1}}, nil)
+		mockClassifier.On("Classify", ctx, requests[1:]).Return([]model.ClassifiedMessage{}, errors.New("model service is down")).Once()
+		mockStorage.On("UpdateMessages", ctx, mock.Anything).Return(nil)
+		mockStorage.On("SaveClassificationWatermark", ctx, mock.Anything).Return(nil)
+
+		assert.NoError(t, wardenBotService.ProcessMessages(ctx))
+		assert.Equal(t, &model.ClassificationWatermark{ChatID: -1, ClassifiedUntil: date, MessageID: 1}, watermark)
+
+		// The next run gets the rest of the second, which must move the watermark too
+		mockStorage.On("GetMessagesAfterWatermark", ctx, watermark).Return(sameSecond[1:], nil).Once()
+		mockClassifier.On("Classify", ctx, requests[1:]).Return([]model.ClassifiedMessage{{MessageID: 2, ChatID: -1, Label: 0}}, nil).Once()
+
+		assert.NoError(t, wardenBotService.ProcessMessages(ctx))
+		assert.Equal(t, &model.ClassificationWatermark{ChatID: -1, ClassifiedUntil: date, MessageID: 2}, watermark)
+		mockStorage.AssertNumberOfCalls(t, "SaveClassificationWatermark", 2)
+	})
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	from := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	mockStorage, _, wardenBotService := setupTest()
+	mockClassifier := new(classifier.MockClassifier)
+	wardenBotService.classifier = mockClassifier
+
+	mockStorage.On("GetMessagesByChatAndRange", ctx, int64(-5), from, to).Return([]model.Message{
+		{MessageID: 1, ChatID: -5, Text: "old", Status: model.MessageStatusClassified},
+	}, nil)
+	mockClassifier.On("Classify", ctx, []model.MessageRequest{{MessageID: 1, ChatID: -5, Text: "old"}}).Return([]model.ClassifiedMessage{
+		{MessageID: 1, ChatID: -5, Category: model.CategoryQuestion},
+	}, nil)
+	mockStorage.On("UpdateMessages", ctx, []*model.Message{
+		{MessageID: 1, ChatID: -5, Label: 1, Category: model.CategoryQuestion, Confidence: 1},
+	}).Return(nil)
+
+	err := wardenBotService.Backfill(ctx, -5, from, to)
+	assert.NoError(t, err)
+
+	mockStorage.AssertExpectations(t)
+	mockStorage.AssertNotCalled(t, "GetGroupChats", ctx)
+	mockStorage.AssertNotCalled(t, "SaveClassificationWatermark", ctx, mock.Anything)
+}
+
+func TestHandleCallbackQuery(t *testing.T) {
+	ctx := context.Background()
+	userID := 7
+	date := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	query := func(data string) *tgbotapi.CallbackQuery {
+		return &tgbotapi.CallbackQuery{
+			ID:      "query",
+			From:    &tgbotapi.User{ID: userID},
+			Message: &tgbotapi.Message{MessageID: 100, Chat: &tgbotapi.Chat{ID: 7, Type: "private"}},
+			Data:    data,
+		}
+	}
+
+	t.Run("Forged data", func(t *testing.T) {
+		_, mockTgBot, wardenBotService := setupTest()
+
+		mockTgBot.On("AnswerCallbackQuery", mock.MatchedBy(func(c tgbotapi.CallbackConfig) bool {
+			return c.ShowAlert
+		})).Return(tgbotapi.APIResponse{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, query("day:1:2024-12-01:forged"))
+
+		mockTgBot.AssertExpectations(t)
+		mockTgBot.AssertNotCalled(t, "Send", mock.Anything)
+	})
+
+	t.Run("Chat selected without date", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.EditMessageTextConfig) bool {
+			return c.MessageID == 100 && c.ReplyMarkup != nil
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, query(wardenBotService.signer.Sign(userID, callbackChat, "-1")))
+
+		mockTgBot.AssertExpectations(t)
+	})
+
+	t.Run("Day selected", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date, date.AddDate(0, 0, 1)).Return([]*model.Message{
+			{MessageID: 1, ChatID: -1, Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date.AddDate(0, 0, -30), date).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return c.ChatID == 7 && strings.Contains(c.Text, "Team chat")
+		})).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.PhotoConfig) bool {
+			return c.ChatID == 7
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, query(wardenBotService.signer.Sign(userID, callbackDay, "-1", "2024-12-01")))
+
+		mockTgBot.AssertExpectations(t)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Report send failure is reported", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date, date.AddDate(0, 0, 1)).Return([]*model.Message{
+			{MessageID: 1, ChatID: -1, Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date.AddDate(0, 0, -30), date).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return c.ParseMode == report.ParseMode
+		})).Return(tgbotapi.Message{}, errors.New("Bad Request: can't parse entities"))
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return c.ChatID == 7 && strings.HasPrefix(c.Text, "Не удалось отправить отчет")
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, query(wardenBotService.signer.Sign(userID, callbackDay, "-1", "2024-12-01")))
+
+		mockTgBot.AssertExpectations(t)
+		mockTgBot.AssertNotCalled(t, "Send", mock.AnythingOfType("tgbotapi.PhotoConfig"))
+	})
+
+	t.Run("Day selected for export", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		wardenBotService.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepSelectDate, ChatID: -1, Format: report.FormatUsers})
+
+		mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date, date.AddDate(0, 0, 1)).Return([]*model.Message{
+			{MessageID: 1, ChatID: -1, UserFullName: "John Doe", Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.DocumentConfig) bool {
+			file, ok := c.File.(tgbotapi.FileBytes)
+			return c.ChatID == 7 && ok && file.Name == "report_-1_2024-12-01_2024-12-01_users.csv"
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, query(wardenBotService.signer.Sign(userID, callbackDay, "-1", "2024-12-01")))
+
+		mockTgBot.AssertExpectations(t)
+		mockStorage.AssertExpectations(t)
+		_, exists, _ := wardenBotService.botState.GetUserState(ctx, userID)
+		assert.False(t, exists)
+	})
+
+	t.Run("Chat selected with period", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		to := date.AddDate(0, 0, 7)
+		wardenBotService.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepSelectChat, Period: "2024-12-01..2024-12-07"})
+
+		mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date, to).Return([]*model.Message{
+			{MessageID: 1, ChatID: -1, Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date.AddDate(0, 0, -30), date).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return c.ChatID == 7 && strings.Contains(c.Text, "01.12.2024 – 07.12.2024")
+		})).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.PhotoConfig) bool {
+			return c.ChatID == 7
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, query(wardenBotService.signer.Sign(userID, callbackChat, "-1")))
+
+		mockTgBot.AssertExpectations(t)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Day selected for thread", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		wardenBotService.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepSelectDate, ChatID: -1, ThreadID: 10})
+
+		mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date, date.AddDate(0, 0, 1)).Return([]*model.Message{
+			{MessageID: 10, ChatID: -1, Text: "release plan", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 11, ChatID: -1, Text: "lol", Date: date, Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+			{MessageID: 12, ChatID: -1, Text: "deploy", Date: date, Label: 1, Confidence: 1, Status: model.MessageStatusClassified, ThreadID: 10},
+		}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), date.AddDate(0, 0, -30), date).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return strings.Contains(c.Text, "Team chat (ветка #10)") && strings.Contains(c.Text, "Всего сообщений: 2")
+		})).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.PhotoConfig")).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.handleCallbackQuery(ctx, query(wardenBotService.signer.Sign(userID, callbackDay, "-1", "2024-12-01")))
+
+		mockTgBot.AssertExpectations(t)
+		mockStorage.AssertExpectations(t)
+	})
+}
+
+func TestProcessReportCommand(t *testing.T) {
+	ctx := context.Background()
+	userID := 7
+
+	reportMessage := func(text string) *tgbotapi.Message {
+		return &tgbotapi.Message{
+			Text:     text,
+			Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/report")}},
+			From:     &tgbotapi.User{ID: userID},
+			Chat:     &tgbotapi.Chat{ID: 7, Type: "private"},
+		}
+	}
+
+	t.Run("Thread and period", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetGroupChats", ctx).Return([]model.Chat{{ChatID: -1, Title: "Team chat"}}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.processReportCommand(ctx, reportMessage("/report #10 week"), userID, i18n.DefaultLocale)
+
+		conversation, exists, _ := wardenBotService.botState.GetUserState(ctx, userID)
+		assert.True(t, exists)
+		assert.Equal(t, uint64(10), conversation.ThreadID)
+		assert.Equal(t, "week", conversation.Period)
+	})
+
+	t.Run("Invalid thread", func(t *testing.T) {
+		_, mockTgBot, wardenBotService := setupTest()
+
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return strings.HasPrefix(c.Text, "Ветка указывается номером")
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.processReportCommand(ctx, reportMessage("/report #topic"), userID, i18n.DefaultLocale)
+
+		mockTgBot.AssertExpectations(t)
+		_, exists, _ := wardenBotService.botState.GetUserState(ctx, userID)
+		assert.False(t, exists)
+	})
+}
+
+func TestCalendarKeyboard(t *testing.T) {
+	_, _, wardenBotService := setupTest()
+	month := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2024, 12, 10, 15, 0, 0, 0, time.UTC)
+
+	keyboard := wardenBotService.calendarKeyboard(7, -1001234567890, month, today, i18n.DefaultLocale)
+	rows := keyboard.InlineKeyboard
+
+	// Navigation, weekdays and six weeks: December 2024 starts on Sunday
+	assert.Equal(t, 8, len(rows))
+	assert.Equal(t, "Декабрь 2024", rows[0][1].Text)
+	assert.Equal(t, callbackNoop, *rows[0][2].CallbackData)
+	assert.Equal(t, "1", rows[2][6].Text)
+	assert.Equal(t, callbackNoop, *rows[2][0].CallbackData)
+
+	action, args, err := wardenBotService.signer.Verify(7, *rows[3][6].CallbackData)
+	assert.NoError(t, err)
+	assert.Equal(t, callbackDay, action)
+	assert.Equal(t, []string{"-1001234567890", "2024-12-08"}, args)
+
+	// Days after today are not selectable
+	assert.Equal(t, "11", rows[4][2].Text)
+	assert.Equal(t, callbackNoop, *rows[4][2].CallbackData)
+	for _, row := range rows {
+		for _, button := range row {
+			assert.LessOrEqual(t, len(*button.CallbackData), 64)
+		}
+	}
+}
+
 func setupTest() (*storage.MockStorage, *bot.MockTgBotAPI, *WardenBotService) {
 	mockStorage := new(storage.MockStorage)
 	mockTgBot := new(bot.MockTgBotAPI)
 	wardenBotService := &WardenBotService{
-		tgBot:   mockTgBot,
-		storage: mockStorage,
+		tgBot:           mockTgBot,
+		storage:         mockStorage,
+		botState:        state.NewBotState(time.Minute),
+		reportGenerator: report.NewReportGenerator(mockStorage, 0),
+		signer:          callback.NewSigner("secret"),
 	}
+	// Users without a saved language
+	mockStorage.On("GetUserLocale", mock.Anything, mock.Anything).Return("", nil).Maybe()
 	return mockStorage, mockTgBot, wardenBotService
 }
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/report"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/state"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Settings accepted in the settings dialog as "<name> <value>"
+const (
+	settingHigh    = "high"
+	settingLow     = "low"
+	settingSamples = "samples"
+	settingTop     = "top"
+	// settingLabel is followed by high, normal or low and the label text, an empty text restores the default
+	settingLabel = "label"
+	settingReset = "reset"
+	// settingTimezone is followed by an IANA name such as Europe/Moscow, an empty name restores UTC
+	settingTimezone = "timezone"
+
+	maxSettingLimit = 50
+	maxLabelLength  = 100
+)
+
+var errInvalidSetting = errors.New("invalid setting")
+
+// settingError keeps the catalog message of an invalid setting to show it in the language of the user.
+type settingError struct {
+	key  string
+	args []any
+}
+
+func invalidSetting(key string, args ...any) error {
+	return &settingError{key: key, args: args}
+}
+
+func (e *settingError) Error() string {
+	return fmt.Sprintf("%v: %s", errInvalidSetting, i18n.T(i18n.LocaleEn, e.key, e.args...))
+}
+
+func (e *settingError) Unwrap() error {
+	return errInvalidSetting
+}
+
+func (s *WardenBotService) processSettingsCommand(ctx context.Context, message *tgbotapi.Message, userID int, locale string) {
+	adminChats, err := s.GetAdminChats(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to get admin chats: %v", err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.admin_chats")))
+		return
+	}
+
+	if len(adminChats) == 0 {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.no_admin_chats")))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "settings.select_chat"))
+	msg.ReplyMarkup = s.chatsKeyboard(userID, adminChats, callbackSettings)
+	s.tgBot.Send(msg)
+}
+
+// editSettings shows the settings of the chat and waits for changes typed by the user.
+func (s *WardenBotService) editSettings(ctx context.Context, privateChatID int64, messageID int, userID int, chatID int64, locale string) {
+	text, err := s.settingsText(ctx, userID, chatID, locale)
+	if err != nil {
+		log.Printf("Failed to show settings of chat %d: %v", chatID, err)
+		s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, text))
+		return
+	}
+
+	if err := s.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepEditSettings, ChatID: chatID}); err != nil {
+		log.Printf("Failed to save state of user %d: %v", userID, err)
+	}
+	s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, text+"\n\n"+i18n.T(locale, "settings.help")))
+}
+
+func (s *WardenBotService) processSettingsInput(ctx context.Context, message *tgbotapi.Message, userID int, chatID int64, locale string) {
+	isAdmin, err := s.isChatAdmin(chatID, userID)
+	if err != nil || !isAdmin {
+		s.clearUserState(ctx, userID)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.not_admin")))
+		return
+	}
+
+	settings, err := s.storage.GetChatSettings(ctx, chatID)
+	if err != nil {
+		log.Printf("Failed to get settings of chat %d: %v", chatID, err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "settings.error_get")))
+		return
+	}
+
+	if err := applySetting(settings, message.Text); err != nil {
+		reason := err.Error()
+		var settingErr *settingError
+		if errors.As(err, &settingErr) {
+			reason = i18n.T(locale, settingErr.key, settingErr.args...)
+		}
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "settings.invalid", reason, i18n.T(locale, "settings.help"))))
+		return
+	}
+
+	if err := s.storage.SaveChatSettings(ctx, settings); err != nil {
+		log.Printf("Failed to save settings of chat %d: %v", chatID, err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "settings.error_save")))
+		return
+	}
+
+	// The dialog is extended, so several settings can be changed in a row
+	if err := s.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepEditSettings, ChatID: chatID}); err != nil {
+		log.Printf("Failed to save state of user %d: %v", userID, err)
+	}
+
+	text, _ := s.settingsText(ctx, userID, chatID, locale)
+	s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "settings.saved", text)))
+}
+
+// settingsText re-checks admin rights and describes the settings, on error the text is meant for the user.
+func (s *WardenBotService) settingsText(ctx context.Context, userID int, chatID int64, locale string) (string, error) {
+	isAdmin, err := s.isChatAdmin(chatID, userID)
+	if err != nil {
+		return i18n.T(locale, "error.admin_chats"), err
+	}
+	if !isAdmin {
+		return i18n.T(locale, "error.not_admin"), fmt.Errorf("user %d is not admin", userID)
+	}
+
+	chat, err := s.storage.GetChatInfoByID(ctx, chatID)
+	if err != nil {
+		return i18n.T(locale, "settings.error_get"), err
+	}
+	settings, err := s.storage.GetChatSettings(ctx, chatID)
+	if err != nil {
+		return i18n.T(locale, "settings.error_get"), err
+	}
+
+	highLabel, normalLabel, lowLabel := report.IndicatorLabels(settings, locale)
+	return i18n.T(locale, "settings.text",
+		chat.Title,
+		settings.HighProductivityBelow, highLabel,
+		settings.LowProductivityAbove, lowLabel,
+		normalLabel,
+		settings.SampleLimit,
+		settings.TopUsersLimit,
+		settings.Location(),
+	), nil
+}
+
+// applySetting changes the settings according to one "<name> <value>" line typed by the user.
+func applySetting(settings *model.ChatSettings, input string) error {
+	name, value, _ := strings.Cut(strings.TrimSpace(input), " ")
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(name) {
+	case settingHigh, settingLow:
+		percentage, err := strconv.ParseFloat(value, 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return invalidSetting("settings.threshold")
+		}
+		high, low := settings.HighProductivityBelow, settings.LowProductivityAbove
+		if strings.ToLower(name) == settingHigh {
+			high = percentage
+		} else {
+			low = percentage
+		}
+		if high > low {
+			return invalidSetting("settings.threshold_order", high, low)
+		}
+		settings.HighProductivityBelow, settings.LowProductivityAbove = high, low
+	case settingSamples, settingTop:
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSettingLimit {
+			return invalidSetting("settings.limit", maxSettingLimit)
+		}
+		if strings.ToLower(name) == settingSamples {
+			settings.SampleLimit = limit
+		} else {
+			settings.TopUsersLimit = limit
+		}
+	case settingLabel:
+		level, label, _ := strings.Cut(value, " ")
+		label = strings.TrimSpace(label)
+		if len([]rune(label)) > maxLabelLength {
+			return invalidSetting("settings.label_length", maxLabelLength)
+		}
+		switch strings.ToLower(level) {
+		case "high":
+			settings.HighLabel = label
+		case "normal":
+			settings.NormalLabel = label
+		case "low":
+			settings.LowLabel = label
+		default:
+			return invalidSetting("settings.label_level")
+		}
+	case settingTimezone:
+		if value == "" {
+			settings.Timezone = ""
+			break
+		}
+		// Local depends on the server, not on the chat
+		if _, err := time.LoadLocation(value); err != nil || value == "Local" {
+			return invalidSetting("settings.timezone", value)
+		}
+		settings.Timezone = value
+	case settingReset:
+		*settings = *model.DefaultChatSettings(settings.ChatID)
+	default:
+		return invalidSetting("settings.unknown", name)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/state"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestApplySetting(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    func(settings *model.ChatSettings)
+		wantErr bool
+	}{
+		{input: "high 10", want: func(s *model.ChatSettings) { s.HighProductivityBelow = 10 }},
+		{input: "LOW 75.5", want: func(s *model.ChatSettings) { s.LowProductivityAbove = 75.5 }},
+		{input: "samples 3", want: func(s *model.ChatSettings) { s.SampleLimit = 3 }},
+		{input: "top 5", want: func(s *model.ChatSettings) { s.TopUsersLimit = 5 }},
+		{input: "label high Так держать!", want: func(s *model.ChatSettings) { s.HighLabel = "Так держать!" }},
+		{input: "label normal", want: func(s *model.ChatSettings) { s.NormalLabel = "" }},
+		{input: "timezone Europe/Moscow", want: func(s *model.ChatSettings) { s.Timezone = "Europe/Moscow" }},
+		{input: "timezone", want: func(s *model.ChatSettings) { s.Timezone = "" }},
+		{input: "timezone Mars/Olympus", wantErr: true},
+		{input: "high 60", wantErr: true},
+		{input: "low 101", wantErr: true},
+		{input: "samples 0", wantErr: true},
+		{input: "label middle text", wantErr: true},
+		{input: "colour red", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			settings := model.DefaultChatSettings(-1)
+			settings.NormalLabel = "Так себе"
+			err := applySetting(settings, tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errInvalidSetting)
+				return
+			}
+			assert.NoError(t, err)
+
+			want := model.DefaultChatSettings(-1)
+			want.NormalLabel = "Так себе"
+			tt.want(want)
+			assert.Equal(t, want, settings)
+		})
+	}
+
+	t.Run("reset", func(t *testing.T) {
+		settings := &model.ChatSettings{ChatID: -1, SampleLimit: 3, HighLabel: "Отлично"}
+		assert.NoError(t, applySetting(settings, "reset"))
+		assert.Equal(t, model.DefaultChatSettings(-1), settings)
+	})
+}
+
+func TestProcessSettingsInput(t *testing.T) {
+	ctx := context.Background()
+	userID := 7
+	message := &tgbotapi.Message{Text: "top 3", From: &tgbotapi.User{ID: userID}, Chat: &tgbotapi.Chat{ID: 7, Type: "private"}}
+
+	t.Run("Admin changes setting", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		wardenBotService.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepEditSettings, ChatID: -1})
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil).Once()
+		mockStorage.On("SaveChatSettings", ctx, mock.MatchedBy(func(s *model.ChatSettings) bool {
+			return s.ChatID == -1 && s.TopUsersLimit == 3
+		})).Return(nil)
+		saved := model.DefaultChatSettings(-1)
+		saved.TopUsersLimit = 3
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(saved, nil).Once()
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return strings.HasPrefix(c.Text, "Сохранено.") && strings.Contains(c.Text, "Пользователей в отчете: 3")
+		})).Return(tgbotapi.Message{}, nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: message})
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+	})
+
+	t.Run("Former admin", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		wardenBotService.botState.SetUserState(ctx, userID, &state.Conversation{Step: state.StepEditSettings, ChatID: -1})
+		mockStorage.On("SaveChatInfo", ctx, mock.Anything).Return(nil)
+
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{}, nil)
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil)
+
+		err := wardenBotService.handleUpdate(ctx, tgbotapi.Update{Message: message})
+		assert.NoError(t, err)
+
+		mockStorage.AssertNotCalled(t, "SaveChatSettings", ctx, mock.Anything)
+		_, exists, _ := wardenBotService.botState.GetUserState(ctx, userID)
+		assert.False(t, exists)
+	})
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBState keeps conversations in Postgres, so pending dialogs survive restarts.
+type DBState struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewDBState(db *gorm.DB, ttl time.Duration) *DBState {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &DBState{db: db, ttl: ttl}
+}
+
+func (s *DBState) SetUserState(ctx context.Context, userID int, state *Conversation) error {
+	conversation := *state
+	conversation.UserID = userID
+	conversation.ExpiresAt = time.Now().Add(s.ttl)
+
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&conversation).Error
+	if err != nil {
+		return fmt.Errorf("failed to save state of user %d: %w", userID, err)
+	}
+
+	// Expired dialogs are swept lazily, nothing else reads them
+	if err := s.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&Conversation{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired states: %w", err)
+	}
+	return nil
+}
+
+func (s *DBState) GetUserState(ctx context.Context, userID int) (*Conversation, bool, error) {
+	conversation := Conversation{}
+	err := s.db.WithContext(ctx).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Take(&conversation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch state of user %d: %w", userID, err)
+	}
+	return &conversation, true, nil
+}
+
+func (s *DBState) ClearUserState(ctx context.Context, userID int) error {
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&Conversation{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to clear state of user %d: %w", userID, err)
+	}
+	return nil
+}
@@ -1,26 +1,104 @@
 package state
 
-import "time"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
+const DefaultTTL = 30 * time.Minute
+
+const (
+	StepSelectChat = "select_chat"
+	StepSelectDate = "select_date"
+	// StepEditSettings waits for setting changes of ChatID typed by the user
+	StepEditSettings = "edit_settings"
+)
+
+// Conversation is the state of a pending dialog with a user in a private chat.
+type Conversation struct {
+	UserID    int       `json:"userId" gorm:"primaryKey"`
+	Step      string    `json:"step"`
+	ChatID    int64     `json:"chatId"`
+	Format    string    `json:"format"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Period is the period argument of the command, it is resolved in the timezone of the chat once it is selected
+	Period string `json:"period"`
+	// ThreadID limits the report to one thread of the chat, 0 means the whole chat
+	ThreadID uint64 `json:"threadId"`
+}
+
+func (c *Conversation) TableName() string {
+	return "conversations"
+}
+
+type Store interface {
+	GetUserState(ctx context.Context, userID int) (*Conversation, bool, error)
+	SetUserState(ctx context.Context, userID int, state *Conversation) error
+	ClearUserState(ctx context.Context, userID int) error
+}
+
+// BotState keeps conversations in memory, they are lost on restart.
 type BotState struct {
-	UserStates map[int]time.Time
+	mu         sync.Mutex
+	ttl        time.Duration
+	now        func() time.Time
+	userStates map[int]Conversation
 }
 
-func NewBotState() *BotState {
+func NewBotState(ttl time.Duration) *BotState {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
 	return &BotState{
-		UserStates: make(map[int]time.Time),
+		ttl:        ttl,
+		now:        time.Now,
+		userStates: make(map[int]Conversation),
 	}
 }
 
-func (s *BotState) SetUserState(userID int, state time.Time) {
-	s.UserStates[userID] = state
+// SetUserState stores a copy of the state and extends its expiration by the TTL.
+func (s *BotState) SetUserState(ctx context.Context, userID int, state *Conversation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.removeExpired(now)
+
+	conversation := *state
+	conversation.UserID = userID
+	conversation.ExpiresAt = now.Add(s.ttl)
+	s.userStates[userID] = conversation
+	return nil
 }
 
-func (s *BotState) GetUserState(userID int) (time.Time, bool) {
-	state, exists := s.UserStates[userID]
-	return state, exists
+func (s *BotState) GetUserState(ctx context.Context, userID int) (*Conversation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, exists := s.userStates[userID]
+	if !exists {
+		return nil, false, nil
+	}
+	if !s.now().Before(conversation.ExpiresAt) {
+		delete(s.userStates, userID)
+		return nil, false, nil
+	}
+	return &conversation, true, nil
 }
 
-func (s *BotState) ClearUserState(userID int) {
-	delete(s.UserStates, userID)
+func (s *BotState) ClearUserState(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.userStates, userID)
+	return nil
+}
+
+func (s *BotState) removeExpired(now time.Time) {
+	for userID, conversation := range s.userStates {
+		if !now.Before(conversation.ExpiresAt) {
+			delete(s.userStates, userID)
+		}
+	}
 }
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotState(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Expiration", func(t *testing.T) {
+		now := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+		botState := NewBotState(time.Minute)
+		botState.now = func() time.Time { return now }
+
+		err := botState.SetUserState(ctx, 1, &Conversation{Step: StepSelectDate, ChatID: -10})
+		assert.NoError(t, err)
+
+		conversation, exists, err := botState.GetUserState(ctx, 1)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, 1, conversation.UserID)
+		assert.Equal(t, int64(-10), conversation.ChatID)
+		assert.Equal(t, StepSelectDate, conversation.Step)
+
+		now = now.Add(time.Minute)
+		_, exists, err = botState.GetUserState(ctx, 1)
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		botState := NewBotState(time.Minute)
+
+		assert.NoError(t, botState.SetUserState(ctx, 1, &Conversation{Step: StepSelectChat}))
+		assert.NoError(t, botState.ClearUserState(ctx, 1))
+
+		_, exists, _ := botState.GetUserState(ctx, 1)
+		assert.False(t, exists)
+	})
+
+	t.Run("Concurrent access", func(t *testing.T) {
+		botState := NewBotState(time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				botState.SetUserState(ctx, i%5, &Conversation{Step: StepSelectChat})
+				botState.GetUserState(ctx, i%5)
+				botState.ClearUserState(ctx, i%7)
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -8,18 +8,44 @@ import (
 
 	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Storage interface {
 	PutMessage(ctx context.Context, message *model.Message) error
 	UpdateMessages(ctx context.Context, messages []*model.Message) error
-	GetMessagesForLastDayByChat(ctx context.Context, chatID uint64) ([]model.Message, error)
+	GetMessagesAfterWatermark(ctx context.Context, watermark *model.ClassificationWatermark) ([]model.Message, error)
+	GetMessagesByChatAndRange(ctx context.Context, chatID int64, from, to time.Time) ([]model.Message, error)
 	SaveChatInfo(ctx context.Context, chatInfo *model.Chat) error
 	GetGroupChats(ctx context.Context) ([]model.Chat, error)
-	GetMessagesByChatAndPeriod(ctx context.Context, chatID uint64, date time.Time) ([]*model.Message, error)
-	GetChatInfoByID(ctx context.Context, chatID uint64) (*model.Chat, error)
+	GetMessagesByChatAndPeriod(ctx context.Context, chatID int64, from, to time.Time) ([]*model.Message, error)
+	GetChatInfoByID(ctx context.Context, chatID int64) (*model.Chat, error)
+	GetUpdateOffset(ctx context.Context) (int, error)
+	SaveUpdateOffset(ctx context.Context, updateID int) error
+	GetClassificationWatermark(ctx context.Context, chatID int64) (*model.ClassificationWatermark, error)
+	SaveClassificationWatermark(ctx context.Context, watermark *model.ClassificationWatermark) error
+	SaveSubscription(ctx context.Context, subscription *model.Subscription) error
+	DeleteSubscription(ctx context.Context, userID int, chatID int64) error
+	GetSubscriptions(ctx context.Context) ([]model.Subscription, error)
+	GetUserSubscriptions(ctx context.Context, userID int) ([]model.Subscription, error)
+	MarkSubscriptionSent(ctx context.Context, userID int, chatID int64, sentAt time.Time) error
+	GetChatSettings(ctx context.Context, chatID int64) (*model.ChatSettings, error)
+	SaveChatSettings(ctx context.Context, settings *model.ChatSettings) error
+	GetUserLocale(ctx context.Context, userID int) (string, error)
+	SaveUserLocale(ctx context.Context, userID int, locale string) error
+	SaveUser(ctx context.Context, user *model.User) error
+	GetUsersByIDs(ctx context.Context, userIDs []int) ([]model.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	GetMessagesByUserAndPeriod(ctx context.Context, userID int, chatID int64, from, to time.Time) ([]*model.Message, error)
+	EditMessage(ctx context.Context, chatID int64, messageID uint64, text, caption string, editedAt time.Time) error
+	GetMessageThreadID(ctx context.Context, chatID int64, messageID uint64) (uint64, error)
+	MigrateChat(ctx context.Context, fromChatID, toChatID int64) error
+	DeactivateChat(ctx context.Context, chatID int64) error
 }
 
+// updateOffsetID is the key of the single row holding the last processed update.
+const updateOffsetID = 1
+
 type DBStorage struct {
 	db *gorm.DB
 }
@@ -29,7 +55,8 @@ func NewDBStorage(db *gorm.DB) *DBStorage {
 }
 
 func (s *DBStorage) PutMessage(ctx context.Context, message *model.Message) error {
-	err := s.db.Create(message).Error
+	// Replayed updates must not fail on the primary key
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(message).Error
 	if err != nil {
 		return err
 	}
@@ -41,6 +68,9 @@ func (s *DBStorage) UpdateMessages(ctx context.Context, messages []*model.Messag
 		updates := make(map[string]interface{})
 
 		updates["label"] = msg.Label
+		updates["category"] = msg.Category
+		updates["confidence"] = msg.Confidence
+		updates["status"] = model.MessageStatusClassified
 
 		if err := s.db.
 			WithContext(ctx).
@@ -53,46 +83,180 @@ func (s *DBStorage) UpdateMessages(ctx context.Context, messages []*model.Messag
 	return nil
 }
 
-func (s *DBStorage) GetMessagesForLastDayByChat(ctx context.Context, chatID uint64) ([]model.Message, error) {
+// EditMessage moves the current text and caption of the message into its history, replaces them and queues the message
+// for classification again. Unknown messages and edits that keep both, e.g. replayed updates, are ignored.
+func (s *DBStorage) EditMessage(ctx context.Context, chatID int64, messageID uint64, text, caption string, editedAt time.Time) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		message := model.Message{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("message_id = ? AND chat_id = ?", messageID, chatID).
+			Take(&message).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if message.Text == text && message.Caption == caption {
+			return nil
+		}
+
+		revision := &model.MessageRevision{
+			MessageID: messageID,
+			ChatID:    chatID,
+			Text:      message.Text,
+			Caption:   message.Caption,
+			EditedAt:  editedAt.UTC(),
+		}
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&model.Message{}).
+			Where("message_id = ? AND chat_id = ?", messageID, chatID).
+			Updates(map[string]interface{}{"text": text, "caption": caption, "status": model.MessageStatusPending}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to edit message %d: %w", messageID, err)
+	}
+	return nil
+}
+
+// MigrateChat makes fromChatID a part of the history of toChatID, e.g. when a group is upgraded to a supergroup.
+// Messages keep their chat because message IDs of the chats may overlap, queries by chat include migrated chats.
+// Settings and subscriptions move to the new chat unless it already has its own. The new chat continues from
+// the classification watermark of the old one, so the merged history is not classified again.
+// Repeated calls change nothing.
+func (s *DBStorage) MigrateChat(ctx context.Context, fromChatID, toChatID int64) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.Chat{}).
+			Where("chat_id = ? OR migrated_to_chat_id = ?", fromChatID, fromChatID).
+			Updates(map[string]interface{}{"active": false, "migrated_to_chat_id": toChatID}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`UPDATE chat_settings SET chat_id = ? WHERE chat_id = ?
+			AND NOT EXISTS (SELECT 1 FROM chat_settings WHERE chat_id = ?)`, toChatID, fromChatID, toChatID).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`UPDATE subscriptions SET chat_id = ? WHERE chat_id = ?
+			AND user_id NOT IN (SELECT user_id FROM subscriptions WHERE chat_id = ?)`, toChatID, fromChatID, toChatID).Error
+		if err != nil {
+			return err
+		}
+
+		// The new chat may be unknown yet when the event arrives to the old chat, the event of the new chat copies it then.
+		// A watermark the new chat already has is only moved forward.
+		return tx.Exec(`INSERT INTO classification_watermarks (chat_id, classified_until, message_id)
+			SELECT ?, classified_until, message_id FROM classification_watermarks
+			WHERE chat_id = ? AND EXISTS (SELECT 1 FROM chats WHERE chat_id = ?)
+			ON CONFLICT (chat_id) DO UPDATE SET classified_until = EXCLUDED.classified_until, message_id = EXCLUDED.message_id
+			WHERE (classification_watermarks.classified_until, classification_watermarks.message_id)
+				< (EXCLUDED.classified_until, EXCLUDED.message_id)`, toChatID, fromChatID, toChatID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate chat %d to %d: %w", fromChatID, toChatID, err)
+	}
+	return nil
+}
+
+// DeactivateChat hides the chat from GetGroupChats, its history is kept.
+func (s *DBStorage) DeactivateChat(ctx context.Context, chatID int64) error {
+	err := s.db.WithContext(ctx).Model(&model.Chat{}).Where("chat_id = ?", chatID).Update("active", false).Error
+	if err != nil {
+		return fmt.Errorf("failed to deactivate chat %d: %w", chatID, err)
+	}
+	return nil
+}
+
+// chatHistory selects the IDs of the chat and of the chats that migrated into it.
+func (s *DBStorage) chatHistory(chatID int64) *gorm.DB {
+	return s.db.Model(&model.Chat{}).Select("chat_id").Where("chat_id = ? OR migrated_to_chat_id = ?", chatID, chatID)
+}
+
+// GetMessageThreadID returns the thread of the stored message, 0 for unknown messages and messages outside of threads.
+func (s *DBStorage) GetMessageThreadID(ctx context.Context, chatID int64, messageID uint64) (uint64, error) {
+	message := model.Message{}
+	err := s.db.WithContext(ctx).
+		Select("thread_id").
+		Where("message_id = ? AND chat_id = ?", messageID, chatID).
+		Take(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get thread of message %d: %w", messageID, err)
+	}
+	return message.ThreadID, nil
+}
+
+// GetMessagesAfterWatermark also returns pending messages behind the watermark, e.g. ones saved after
+// a later message of the same chat had already been classified.
+func (s *DBStorage) GetMessagesAfterWatermark(ctx context.Context, watermark *model.ClassificationWatermark) ([]model.Message, error) {
+	messages := make([]model.Message, 0)
+	err := s.db.WithContext(ctx).
+		Where("chat_id IN (?) AND ((date, message_id) > (?, ?) OR status = ?)",
+			s.chatHistory(watermark.ChatID), watermark.ClassifiedUntil, watermark.MessageID, model.MessageStatusPending).
+		Order("date, message_id").
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (s *DBStorage) GetMessagesByChatAndRange(ctx context.Context, chatID int64, from, to time.Time) ([]model.Message, error) {
 	messages := make([]model.Message, 0)
-	err := s.db.WithContext(ctx).Where("date >= now() - interval '1 day' AND chat_id = ?", chatID).Order("date").Find(&messages).Error
+	err := s.db.WithContext(ctx).
+		Where("chat_id IN (?) AND date >= ? AND date < ?", s.chatHistory(chatID), from.UTC(), to.UTC()).
+		Order("date, message_id").
+		Find(&messages).Error
 	if err != nil {
 		return nil, err
 	}
 	return messages, nil
 }
 
+// SaveChatInfo keeps the latest title and type of the chat and marks it active again, e.g. when the bot is added back.
 func (s *DBStorage) SaveChatInfo(ctx context.Context, chatInfo *model.Chat) error {
-	err := s.db.Create(chatInfo).Error
-	if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
-		return err
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "title", "active"}),
+	}).Create(chatInfo).Error
+	if err != nil {
+		return fmt.Errorf("failed to save chat %d: %w", chatInfo.ChatID, err)
 	}
 	return nil
 }
 
+// GetGroupChats returns the active group chats, chats the bot was removed from or that migrated are skipped.
 func (s *DBStorage) GetGroupChats(ctx context.Context) ([]model.Chat, error) {
 	chats := make([]model.Chat, 0)
-	err := s.db.WithContext(ctx).Where("type LIKE ?", "%group%").Find(&chats).Error
+	err := s.db.WithContext(ctx).Where("type LIKE ? AND active", "%group%").Find(&chats).Error
 	if err != nil {
 		return nil, err
 	}
 	return chats, nil
 }
 
-func (s *DBStorage) GetMessagesByChatAndPeriod(ctx context.Context, chatID uint64, date time.Time) ([]*model.Message, error) {
+// GetMessagesByChatAndPeriod returns the messages of the chat sent in [from, to). The bounds may be in any timezone,
+// dates are compared in UTC as they are stored.
+func (s *DBStorage) GetMessagesByChatAndPeriod(ctx context.Context, chatID int64, from, to time.Time) ([]*model.Message, error) {
 	messages := make([]*model.Message, 0)
-
-	truncatedDate := date.Truncate(24 * time.Hour)
-	dateString := truncatedDate.Format("2006-01-02")
-
-	err := s.db.WithContext(ctx).Where("chat_id = ? and DATE(date) = ?", chatID, dateString).Find(&messages).Error
+	err := s.db.WithContext(ctx).
+		Where("chat_id IN (?) AND date >= ? AND date < ?", s.chatHistory(chatID), from.UTC(), to.UTC()).
+		Order("date, message_id").
+		Find(&messages).Error
 	if err != nil {
 		return nil, err
 	}
 	return messages, nil
 }
 
-func (s *DBStorage) GetChatInfoByID(ctx context.Context, chatID uint64) (*model.Chat, error) {
+func (s *DBStorage) GetChatInfoByID(ctx context.Context, chatID int64) (*model.Chat, error) {
 	chat := model.Chat{}
 	err := s.db.WithContext(ctx).Where("chat_id = ?", chatID).Find(&chat).Error
 	if err != nil {
@@ -100,3 +264,188 @@ func (s *DBStorage) GetChatInfoByID(ctx context.Context, chatID uint64) (*model.
 	}
 	return &chat, nil
 }
+
+func (s *DBStorage) GetUpdateOffset(ctx context.Context) (int, error) {
+	offset := model.UpdateOffset{}
+	err := s.db.WithContext(ctx).Where("id = ?", updateOffsetID).Take(&offset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return offset.UpdateID, nil
+}
+
+func (s *DBStorage) SaveUpdateOffset(ctx context.Context, updateID int) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"update_id"}),
+	}).Create(&model.UpdateOffset{ID: updateOffsetID, UpdateID: updateID}).Error
+	if err != nil {
+		return fmt.Errorf("failed to save update offset %d: %w", updateID, err)
+	}
+	return nil
+}
+
+func (s *DBStorage) GetClassificationWatermark(ctx context.Context, chatID int64) (*model.ClassificationWatermark, error) {
+	watermark := model.ClassificationWatermark{}
+	err := s.db.WithContext(ctx).Where("chat_id = ?", chatID).Take(&watermark).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.ClassificationWatermark{ChatID: chatID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch classification watermark for chat %d: %w", chatID, err)
+	}
+	return &watermark, nil
+}
+
+func (s *DBStorage) SaveClassificationWatermark(ctx context.Context, watermark *model.ClassificationWatermark) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"classified_until", "message_id"}),
+	}).Create(watermark).Error
+	if err != nil {
+		return fmt.Errorf("failed to save classification watermark for chat %d: %w", watermark.ChatID, err)
+	}
+	return nil
+}
+
+func (s *DBStorage) SaveSubscription(ctx context.Context, subscription *model.Subscription) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"private_chat_id", "frequency", "send_at", "last_sent_at", "locale"}),
+	}).Create(subscription).Error
+	if err != nil {
+		return fmt.Errorf("failed to save subscription of user %d to chat %d: %w", subscription.UserID, subscription.ChatID, err)
+	}
+	return nil
+}
+
+func (s *DBStorage) DeleteSubscription(ctx context.Context, userID int, chatID int64) error {
+	err := s.db.WithContext(ctx).Where("user_id = ? AND chat_id = ?", userID, chatID).Delete(&model.Subscription{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription of user %d to chat %d: %w", userID, chatID, err)
+	}
+	return nil
+}
+
+func (s *DBStorage) GetSubscriptions(ctx context.Context) ([]model.Subscription, error) {
+	subscriptions := make([]model.Subscription, 0)
+	err := s.db.WithContext(ctx).Order("user_id, chat_id").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (s *DBStorage) GetUserSubscriptions(ctx context.Context, userID int) ([]model.Subscription, error) {
+	subscriptions := make([]model.Subscription, 0)
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("chat_id").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (s *DBStorage) MarkSubscriptionSent(ctx context.Context, userID int, chatID int64, sentAt time.Time) error {
+	err := s.db.WithContext(ctx).Model(&model.Subscription{}).
+		Where("user_id = ? AND chat_id = ?", userID, chatID).
+		Update("last_sent_at", sentAt).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark subscription of user %d to chat %d as sent: %w", userID, chatID, err)
+	}
+	return nil
+}
+
+// GetChatSettings returns the default settings for chats that have not changed them.
+func (s *DBStorage) GetChatSettings(ctx context.Context, chatID int64) (*model.ChatSettings, error) {
+	settings := model.ChatSettings{}
+	err := s.db.WithContext(ctx).Where("chat_id = ?", chatID).Take(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.DefaultChatSettings(chatID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch settings of chat %d: %w", chatID, err)
+	}
+	return &settings, nil
+}
+
+func (s *DBStorage) SaveChatSettings(ctx context.Context, settings *model.ChatSettings) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(settings).Error
+	if err != nil {
+		return fmt.Errorf("failed to save settings of chat %d: %w", settings.ChatID, err)
+	}
+	return nil
+}
+
+// GetUserLocale returns an empty locale for users that have not chosen one.
+func (s *DBStorage) GetUserLocale(ctx context.Context, userID int) (string, error) {
+	preferences := model.UserPreferences{}
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Take(&preferences).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch locale of user %d: %w", userID, err)
+	}
+	return preferences.Locale, nil
+}
+
+func (s *DBStorage) SaveUserLocale(ctx context.Context, userID int, locale string) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"locale"}),
+	}).Create(&model.UserPreferences{UserID: userID, Locale: locale}).Error
+	if err != nil {
+		return fmt.Errorf("failed to save locale of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// SaveUser keeps the latest profile of the user.
+func (s *DBStorage) SaveUser(ctx context.Context, user *model.User) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"username", "full_name", "updated_at"}),
+	}).Create(user).Error
+	if err != nil {
+		return fmt.Errorf("failed to save user %d: %w", user.UserID, err)
+	}
+	return nil
+}
+
+func (s *DBStorage) GetUsersByIDs(ctx context.Context, userIDs []int) ([]model.User, error) {
+	users := make([]model.User, 0, len(userIDs))
+	err := s.db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	return users, nil
+}
+
+// GetUserByUsername ignores the case of the username and returns nil for unknown users.
+func (s *DBStorage) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	user := model.User{}
+	err := s.db.WithContext(ctx).Where("LOWER(username) = LOWER(?)", username).Order("updated_at DESC").Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user @%s: %w", username, err)
+	}
+	return &user, nil
+}
+
+// GetMessagesByUserAndPeriod returns the messages of the user in the chat sent in [from, to).
+func (s *DBStorage) GetMessagesByUserAndPeriod(ctx context.Context, userID int, chatID int64, from, to time.Time) ([]*model.Message, error) {
+	messages := make([]*model.Message, 0)
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND chat_id IN (?) AND date >= ? AND date < ?", userID, s.chatHistory(chatID), from.UTC(), to.UTC()).
+		Order("date, message_id").
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
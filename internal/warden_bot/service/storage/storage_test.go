@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordingDriver accepts every statement without a database and keeps them for assertions.
+// Queries return the rows registered for a substring of the query, no rows otherwise.
+type recordingDriver struct {
+	mu         sync.Mutex
+	statements []recordedStatement
+	rows       map[string]*recordedRows
+}
+
+type recordedStatement struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+func (d *recordingDriver) record(query string, args []driver.NamedValue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	values := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg.Value)
+	}
+	d.statements = append(d.statements, recordedStatement{query: query, args: values})
+}
+
+// find returns the recorded statements containing the substring.
+func (d *recordingDriver) find(substr string) []recordedStatement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	found := make([]recordedStatement, 0)
+	for _, statement := range d.statements {
+		if strings.Contains(statement.query, substr) {
+			found = append(found, statement)
+		}
+	}
+	return found
+}
+
+// returnRows makes the queries containing the substring return the row.
+func (d *recordingDriver) returnRows(substr string, columns []string, values ...driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.rows == nil {
+		d.rows = make(map[string]*recordedRows)
+	}
+	d.rows[substr] = &recordedRows{columns: columns, values: values}
+}
+
+func (d *recordingDriver) query(query string) driver.Rows {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for substr, rows := range d.rows {
+		if strings.Contains(query, substr) {
+			return &recordedRows{columns: rows.columns, values: rows.values}
+		}
+	}
+	return &recordedRows{}
+}
+
+// recordedRows is a result of at most one row.
+type recordedRows struct {
+	columns []string
+	values  []driver.Value
+	read    bool
+}
+
+func (r *recordedRows) Columns() []string { return r.columns }
+
+func (r *recordedRows) Close() error { return nil }
+
+func (r *recordedRows) Next(dest []driver.Value) error {
+	if r.read || r.values == nil {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.driver.record("BEGIN", nil)
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	c.driver.record("COMMIT", nil)
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.driver.record("ROLLBACK", nil)
+	return nil
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.record(query, args)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.driver.record(query, args)
+	return c.driver.query(query), nil
+}
+
+func (c *recordingConn) Ping(context.Context) error { return nil }
+
+func setupStorage(t *testing.T) (*DBStorage, *recordingDriver) {
+	recorder := &recordingDriver{}
+	name := "recording_" + t.Name()
+	sql.Register(name, recorder)
+
+	conn, err := sql.Open(name, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	return NewDBStorage(db), recorder
+}
+
+func TestMigrateChat(t *testing.T) {
+	ctx := context.Background()
+	dbStorage, recorder := setupStorage(t)
+
+	err := dbStorage.MigrateChat(ctx, -123, -1001234567890)
+	assert.NoError(t, err)
+
+	watermarks := recorder.find("INSERT INTO classification_watermarks")
+	require.Len(t, watermarks, 1)
+	assert.Equal(t, []driver.Value{int64(-1001234567890), int64(-123), int64(-1001234567890)}, watermarks[0].args)
+
+	// The watermark moves together with the chat in one transaction
+	assert.Equal(t, "BEGIN", recorder.statements[0].query)
+	assert.Equal(t, "COMMIT", recorder.statements[len(recorder.statements)-1].query)
+}
+
+func TestEditMessage(t *testing.T) {
+	ctx := context.Background()
+	editedAt := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Edit keeps the previous text", func(t *testing.T) {
+		dbStorage, recorder := setupStorage(t)
+		recorder.returnRows(`FROM "messages"`, []string{"message_id", "chat_id", "text", "caption", "status"},
+			int64(5), int64(-123), "Hello", "", "classified")
+		recorder.returnRows(`INSERT INTO "message_revisions"`, []string{"id"}, int64(1))
+
+		err := dbStorage.EditMessage(ctx, -123, 5, "Hello, edited", "", editedAt)
+		assert.NoError(t, err)
+
+		locks := recorder.find("FOR UPDATE")
+		require.Len(t, locks, 1)
+
+		revisions := recorder.find(`INSERT INTO "message_revisions"`)
+		require.Len(t, revisions, 1)
+		assert.Contains(t, revisions[0].args, "Hello")
+		assert.Contains(t, revisions[0].args, editedAt)
+
+		updates := recorder.find(`UPDATE "messages"`)
+		require.Len(t, updates, 1)
+		assert.Contains(t, updates[0].args, "Hello, edited")
+		assert.Contains(t, updates[0].args, model.MessageStatusPending)
+		assert.Contains(t, updates[0].query, `"status"=`)
+
+		assert.Equal(t, "BEGIN", recorder.statements[0].query)
+		assert.Equal(t, "COMMIT", recorder.statements[len(recorder.statements)-1].query)
+	})
+
+	t.Run("Unchanged text is ignored", func(t *testing.T) {
+		dbStorage, recorder := setupStorage(t)
+		recorder.returnRows(`FROM "messages"`, []string{"message_id", "chat_id", "text", "caption"},
+			int64(5), int64(-123), "Hello", "")
+
+		assert.NoError(t, dbStorage.EditMessage(ctx, -123, 5, "Hello", "", editedAt))
+
+		assert.Empty(t, recorder.find(`INSERT INTO "message_revisions"`))
+		assert.Empty(t, recorder.find(`UPDATE "messages"`))
+	})
+
+	t.Run("Unknown message is ignored", func(t *testing.T) {
+		dbStorage, recorder := setupStorage(t)
+
+		assert.NoError(t, dbStorage.EditMessage(ctx, -123, 5, "Hello", "", editedAt))
+
+		assert.Empty(t, recorder.find(`INSERT INTO "message_revisions"`))
+		assert.Empty(t, recorder.find(`UPDATE "messages"`))
+	})
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/report"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	sendAtLayout = "15:04"
+	// sendAtDataLayout is used in callback data where ':' separates the arguments
+	sendAtDataLayout = "1504"
+	defaultSendAt    = "09:00"
+)
+
+// frequencyKeys are the catalog keys of the frequency names
+var frequencyKeys = map[string]string{
+	model.FrequencyDaily:  "frequency.daily",
+	model.FrequencyWeekly: "frequency.weekly",
+}
+
+// DispatchSubscriptions sends the reports whose delivery time has come since they were last sent.
+// It is called by the scheduler, so a report is delivered on the first run after its time.
+// Delivery times are in the timezone of the chat. A delivery is recorded before the report is sent,
+// so a failed delivery is not repeated, and pages that did arrive are not sent twice, until the next delivery time.
+func (s *WardenBotService) DispatchSubscriptions(ctx context.Context, now time.Time) error {
+	subscriptions, err := s.storage.GetSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch subscriptions: %w", err)
+	}
+
+	var errs []error
+	for _, subscription := range subscriptions {
+		slot, err := lastDelivery(subscription, now.In(s.chatLocation(ctx, subscription.ChatID)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("subscription of user %d to chat %d: %w", subscription.UserID, subscription.ChatID, err))
+			continue
+		}
+		if !subscription.LastSentAt.Before(slot) {
+			continue
+		}
+
+		if err := s.storage.MarkSubscriptionSent(ctx, subscription.UserID, subscription.ChatID, now); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.sendSubscription(ctx, subscription, slot); err != nil {
+			errs = append(errs, fmt.Errorf("subscription of user %d to chat %d: %w", subscription.UserID, subscription.ChatID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *WardenBotService) sendSubscription(ctx context.Context, subscription model.Subscription, slot time.Time) error {
+	// Admin rights may have been revoked after subscribing
+	isAdmin, err := s.isChatAdmin(subscription.ChatID, subscription.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch administrators: %w", err)
+	}
+	if !isAdmin {
+		slog.Info("Subscription dropped, user is no longer admin",
+			slog.Int("user_id", subscription.UserID), slog.Int64("chat_id", subscription.ChatID))
+		return s.storage.DeleteSubscription(ctx, subscription.UserID, subscription.ChatID)
+	}
+
+	period := subscriptionPeriod(subscription.Frequency, slot)
+	chatReport, err := s.reportGenerator.GenerateReport(ctx, subscription.ChatID, period, s.subscriptionLocale(ctx, subscription))
+	if errors.Is(err, report.ErrNoMessages) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.sendReportPages(subscription.PrivateChatID, chatReport.Pages()); err != nil {
+		if isBotBlocked(err) {
+			slog.Info("Subscription dropped, user blocked the bot",
+				slog.Int("user_id", subscription.UserID), slog.Int64("chat_id", subscription.ChatID))
+			return s.storage.DeleteSubscription(ctx, subscription.UserID, subscription.ChatID)
+		}
+		return fmt.Errorf("failed to send report: %w", err)
+	}
+	s.sendChart(subscription.PrivateChatID, chatReport)
+	return nil
+}
+
+// isBotBlocked tells the 403 response for a private chat that will not accept messages anymore,
+// e.g. "Forbidden: bot was blocked by the user".
+func isBotBlocked(err error) bool {
+	var apiErr tgbotapi.Error
+	return errors.As(err, &apiErr) && strings.HasPrefix(apiErr.Message, "Forbidden")
+}
+
+// subscriptionLocale prefers the language chosen by the user after subscribing to the one saved with the subscription.
+func (s *WardenBotService) subscriptionLocale(ctx context.Context, subscription model.Subscription) string {
+	locale, err := s.storage.GetUserLocale(ctx, subscription.UserID)
+	if err != nil {
+		log.Printf("Failed to get locale of user %d: %v", subscription.UserID, err)
+	}
+	if i18n.IsSupported(locale) {
+		return locale
+	}
+	if i18n.IsSupported(subscription.Locale) {
+		return subscription.Locale
+	}
+	return i18n.DefaultLocale
+}
+
+// lastDelivery returns the latest scheduled delivery of the subscription not after now, in the timezone of now.
+// Weekly reports are delivered on Mondays.
+func lastDelivery(subscription model.Subscription, now time.Time) (time.Time, error) {
+	sendAt, err := time.Parse(sendAtLayout, subscription.SendAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid delivery time %q: %w", subscription.SendAt, err)
+	}
+
+	slot := time.Date(now.Year(), now.Month(), now.Day(), sendAt.Hour(), sendAt.Minute(), 0, 0, now.Location())
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -1)
+	}
+
+	switch subscription.Frequency {
+	case model.FrequencyDaily:
+	case model.FrequencyWeekly:
+		slot = slot.AddDate(0, 0, -((int(slot.Weekday()) + 6) % 7))
+	default:
+		return time.Time{}, fmt.Errorf("unknown frequency %q", subscription.Frequency)
+	}
+	return slot, nil
+}
+
+// subscriptionPeriod covers the whole days before the delivery: one day for daily and seven for weekly reports.
+func subscriptionPeriod(frequency string, slot time.Time) report.Period {
+	day := report.DayPeriod(slot).From
+	days := 1
+	if frequency == model.FrequencyWeekly {
+		days = 7
+	}
+	return report.Period{From: day.AddDate(0, 0, -days), To: day}
+}
+
+func (s *WardenBotService) processSubscribeCommand(ctx context.Context, message *tgbotapi.Message, userID int, locale string) {
+	frequency := model.FrequencyDaily
+	sendAt, _ := time.Parse(sendAtLayout, defaultSendAt)
+
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		if _, ok := frequencyKeys[arg]; ok {
+			frequency = arg
+			continue
+		}
+
+		parsed, err := time.Parse(sendAtLayout, arg)
+		if err != nil {
+			s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "subscribe.usage")))
+			return
+		}
+		sendAt = parsed
+	}
+
+	adminChats, err := s.GetAdminChats(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to get admin chats: %v", err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.admin_chats")))
+		return
+	}
+
+	if len(adminChats) == 0 {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.no_admin_chats")))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "subscribe.select_chat"))
+	msg.ReplyMarkup = s.chatsKeyboard(userID, adminChats, callbackSubscribe, frequency, sendAt.Format(sendAtDataLayout))
+	s.tgBot.Send(msg)
+}
+
+func (s *WardenBotService) processUnsubscribeCommand(ctx context.Context, message *tgbotapi.Message, userID int, locale string) {
+	subscriptions, err := s.storage.GetUserSubscriptions(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to get subscriptions of user %d: %v", userID, err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "unsubscribe.error_list")))
+		return
+	}
+
+	if len(subscriptions) == 0 {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "unsubscribe.none")))
+		return
+	}
+
+	chats := make([]model.Chat, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		chat, err := s.storage.GetChatInfoByID(ctx, subscription.ChatID)
+		if err != nil {
+			log.Printf("Failed to get chat info for chat %d: %v", subscription.ChatID, err)
+			continue
+		}
+		chat.Title = i18n.T(locale, "unsubscribe.item", chat.Title, i18n.T(locale, frequencyKeys[subscription.Frequency]), subscription.SendAt)
+		chats = append(chats, *chat)
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "unsubscribe.select"))
+	msg.ReplyMarkup = s.chatsKeyboard(userID, chats, callbackUnsubscribe)
+	s.tgBot.Send(msg)
+}
+
+func (s *WardenBotService) subscribe(ctx context.Context, privateChatID int64, messageID int, userID int, chatID int64, args []string, locale string) {
+	if len(args) < 2 {
+		return
+	}
+	frequency := args[0]
+	if _, ok := frequencyKeys[frequency]; !ok {
+		log.Printf("Unknown subscription frequency %q", frequency)
+		return
+	}
+	sendAt, err := time.Parse(sendAtDataLayout, args[1])
+	if err != nil {
+		log.Printf("Failed to parse subscription time %q: %v", args[1], err)
+		return
+	}
+
+	isAdmin, err := s.isChatAdmin(chatID, userID)
+	if err != nil {
+		log.Printf("Failed to fetch administrators for chat %d: %v", chatID, err)
+		s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "error.admin_chats")))
+		return
+	}
+	if !isAdmin {
+		s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "error.not_admin")))
+		return
+	}
+
+	subscription := &model.Subscription{
+		UserID:        userID,
+		ChatID:        chatID,
+		PrivateChatID: privateChatID,
+		Frequency:     frequency,
+		SendAt:        sendAt.Format(sendAtLayout),
+		// The first report comes at the next scheduled time, not right away
+		LastSentAt: time.Now(),
+		Locale:     locale,
+	}
+	if err := s.storage.SaveSubscription(ctx, subscription); err != nil {
+		log.Printf("Failed to save subscription: %v", err)
+		s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "subscribe.error")))
+		return
+	}
+
+	s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID,
+		i18n.T(locale, "subscribe.done", i18n.T(locale, frequencyKeys[frequency]), subscription.SendAt, s.chatLocation(ctx, chatID))))
+}
+
+func (s *WardenBotService) unsubscribe(ctx context.Context, privateChatID int64, messageID int, userID int, chatID int64, locale string) {
+	if err := s.storage.DeleteSubscription(ctx, userID, chatID); err != nil {
+		log.Printf("Failed to delete subscription: %v", err)
+		s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "unsubscribe.error")))
+		return
+	}
+	s.tgBot.Send(tgbotapi.NewEditMessageText(privateChatID, messageID, i18n.T(locale, "unsubscribe.done")))
+}
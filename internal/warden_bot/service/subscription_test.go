@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLastDelivery(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 12, 4, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		subscription model.Subscription
+		want         time.Time
+	}{
+		{
+			name:         "Daily, time passed today",
+			subscription: model.Subscription{Frequency: model.FrequencyDaily, SendAt: "09:00"},
+			want:         time.Date(2024, 12, 4, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "Daily, time not reached today",
+			subscription: model.Subscription{Frequency: model.FrequencyDaily, SendAt: "18:00"},
+			want:         time.Date(2024, 12, 3, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "Weekly",
+			subscription: model.Subscription{Frequency: model.FrequencyWeekly, SendAt: "09:00"},
+			want:         time.Date(2024, 12, 2, 9, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot, err := lastDelivery(tt.subscription, now)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, slot)
+		})
+	}
+}
+
+func TestDispatchSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 12, 2, 9, 10, 0, 0, time.UTC)
+	day := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Due subscription is sent", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetSubscriptions", ctx).Return([]model.Subscription{
+			{UserID: 7, ChatID: -1, PrivateChatID: 70, Frequency: model.FrequencyDaily, SendAt: "09:00", LastSentAt: now.AddDate(0, 0, -1)},
+			// Already sent after 09:00
+			{UserID: 8, ChatID: -1, PrivateChatID: 80, Frequency: model.FrequencyDaily, SendAt: "09:00", LastSentAt: now.Add(-time.Minute)},
+		}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: 7}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day, day.AddDate(0, 0, 1)).Return([]*model.Message{
+			{MessageID: 1, ChatID: -1, Text: "deploy", Date: day, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day.AddDate(0, 0, -30), day).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return c.ChatID == 70 && strings.Contains(c.Text, "Team chat")
+		})).Return(tgbotapi.Message{}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.PhotoConfig) bool {
+			return c.ChatID == 70
+		})).Return(tgbotapi.Message{}, nil)
+		mockStorage.On("MarkSubscriptionSent", ctx, 7, int64(-1), now).Return(nil)
+
+		err := wardenBotService.DispatchSubscriptions(ctx, now)
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+		mockStorage.AssertNotCalled(t, "MarkSubscriptionSent", ctx, 8, int64(-1), now)
+	})
+
+	t.Run("Former admin is unsubscribed", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetSubscriptions", ctx).Return([]model.Subscription{
+			{UserID: 7, ChatID: -1, PrivateChatID: 70, Frequency: model.FrequencyDaily, SendAt: "09:00"},
+		}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{}, nil)
+		mockStorage.On("DeleteSubscription", ctx, 7, int64(-1)).Return(nil)
+		mockStorage.On("MarkSubscriptionSent", ctx, 7, int64(-1), now).Return(nil)
+
+		err := wardenBotService.DispatchSubscriptions(ctx, now)
+		assert.NoError(t, err)
+
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertNotCalled(t, "Send", mock.Anything)
+	})
+
+	t.Run("Failed page is not sent again", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		settings := model.DefaultChatSettings(-1)
+		settings.SampleLimit = 30
+		messages := make([]*model.Message, 0, 30)
+		for i := range 30 {
+			messages = append(messages, &model.Message{
+				MessageID: uint64(i + 1), ChatID: -1, Text: strings.Repeat("lunch ", 50), Date: day,
+				Confidence: 1, Status: model.MessageStatusClassified,
+			})
+		}
+		subscription := model.Subscription{UserID: 7, ChatID: -1, PrivateChatID: 70, Frequency: model.FrequencyDaily, SendAt: "09:00", LastSentAt: now.AddDate(0, 0, -1)}
+
+		mockStorage.On("GetSubscriptions", ctx).Return([]model.Subscription{subscription}, nil).Once()
+		sent := subscription
+		sent.LastSentAt = now
+		mockStorage.On("GetSubscriptions", ctx).Return([]model.Subscription{sent}, nil).Once()
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(settings, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: 7}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day, day.AddDate(0, 0, 1)).Return(messages, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day.AddDate(0, 0, -30), day).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockStorage.On("MarkSubscriptionSent", ctx, 7, int64(-1), now).Return(nil).Once()
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil).Once()
+		mockTgBot.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, errors.New("Too Many Requests")).Once()
+
+		err := wardenBotService.DispatchSubscriptions(ctx, now)
+		assert.ErrorContains(t, err, "failed to send page 2")
+		assert.NoError(t, wardenBotService.DispatchSubscriptions(ctx, now.Add(time.Minute)))
+
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertNumberOfCalls(t, "Send", 2)
+	})
+
+	t.Run("User blocked the bot", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+
+		mockStorage.On("GetSubscriptions", ctx).Return([]model.Subscription{
+			{UserID: 7, ChatID: -1, PrivateChatID: 70, Frequency: model.FrequencyDaily, SendAt: "09:00", LastSentAt: now.AddDate(0, 0, -1)},
+		}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: 7}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day, day.AddDate(0, 0, 1)).Return([]*model.Message{
+			{MessageID: 1, ChatID: -1, Text: "deploy", Date: day, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day.AddDate(0, 0, -30), day).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockStorage.On("MarkSubscriptionSent", ctx, 7, int64(-1), now).Return(nil)
+		mockTgBot.On("Send", mock.Anything).Return(tgbotapi.Message{}, tgbotapi.Error{Message: "Forbidden: bot was blocked by the user"})
+		mockStorage.On("DeleteSubscription", ctx, 7, int64(-1)).Return(nil)
+
+		assert.NoError(t, wardenBotService.DispatchSubscriptions(ctx, now))
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Delivery time is in chat timezone", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		assert.NoError(t, err)
+		// 09:10 in Tokyo
+		now := time.Date(2024, 12, 2, 0, 10, 0, 0, time.UTC)
+		day := time.Date(2024, 12, 1, 0, 0, 0, 0, tokyo)
+		settings := model.DefaultChatSettings(-1)
+		settings.Timezone = "Asia/Tokyo"
+
+		mockStorage.On("GetSubscriptions", ctx).Return([]model.Subscription{
+			{UserID: 7, ChatID: -1, PrivateChatID: 70, Frequency: model.FrequencyDaily, SendAt: "09:00", LastSentAt: now.AddDate(0, 0, -1)},
+		}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(settings, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: 7}}}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day, day.AddDate(0, 0, 1)).Return([]*model.Message{
+			{MessageID: 1, ChatID: -1, Text: "deploy", Date: day, Label: 1, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockStorage.On("GetMessagesByChatAndPeriod", ctx, int64(-1), day.AddDate(0, 0, -30), day).Return([]*model.Message{}, nil)
+		mockStorage.On("GetChatInfoByID", ctx, int64(-1)).Return(&model.Chat{ChatID: -1, Title: "Team chat"}, nil)
+		mockTgBot.On("Send", mock.Anything).Return(tgbotapi.Message{}, nil)
+		mockStorage.On("MarkSubscriptionSent", ctx, 7, int64(-1), now).Return(nil)
+
+		assert.NoError(t, wardenBotService.DispatchSubscriptions(ctx, now))
+
+		mockStorage.AssertExpectations(t)
+	})
+}
+
+func TestSubscribeCallback(t *testing.T) {
+	ctx := context.Background()
+	mockStorage, mockTgBot, wardenBotService := setupTest()
+
+	mockTgBot.On("AnswerCallbackQuery", mock.Anything).Return(tgbotapi.APIResponse{}, nil)
+	mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: 7}}}, nil)
+	mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+	mockStorage.On("SaveSubscription", ctx, mock.MatchedBy(func(s *model.Subscription) bool {
+		return s.UserID == 7 && s.ChatID == -1 && s.PrivateChatID == 70 && s.Frequency == model.FrequencyWeekly && s.SendAt == "18:30"
+	})).Return(nil)
+	mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.EditMessageTextConfig) bool {
+		return strings.Contains(c.Text, "еженедельно по понедельникам в 18:30 (UTC)")
+	})).Return(tgbotapi.Message{}, nil)
+
+	wardenBotService.handleCallbackQuery(ctx, &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{MessageID: 100, Chat: &tgbotapi.Chat{ID: 70, Type: "private"}},
+		Data:    wardenBotService.signer.Sign(7, callbackSubscribe, "-1", model.FrequencyWeekly, "1830"),
+	})
+
+	mockStorage.AssertExpectations(t)
+	mockTgBot.AssertExpectations(t)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/report"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// processUserReportCommand handles "/userreport @username [period]", the report covers only the chats
+// where the caller is an admin, so it does not reveal messages from other chats.
+func (s *WardenBotService) processUserReportCommand(ctx context.Context, message *tgbotapi.Message, locale string) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || strings.TrimPrefix(args[0], "@") == "" {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "user_report.usage")))
+		return
+	}
+	username := strings.TrimPrefix(args[0], "@")
+
+	periodArg := report.PeriodWeek
+	if len(args) > 1 {
+		periodArg = args[1]
+	}
+	period, err := report.ParsePeriod(periodArg, time.Now())
+	if err != nil {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "report.invalid_period", report.MaxPeriodDays)))
+		return
+	}
+
+	user, err := s.storage.GetUserByUsername(ctx, username)
+	if err != nil {
+		log.Printf("Failed to get user @%s: %v", username, err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "report.error", err.Error())))
+		return
+	}
+	if user == nil {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "user_report.not_found", username)))
+		return
+	}
+
+	adminChats, err := s.GetAdminChats(ctx, message.From.ID)
+	if err != nil {
+		log.Printf("Failed to get admin chats: %v", err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.admin_chats")))
+		return
+	}
+	if len(adminChats) == 0 {
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "error.no_admin_chats")))
+		return
+	}
+
+	userReport, err := s.reportGenerator.GenerateUserReport(ctx, user, adminChats, period, locale)
+	if err != nil {
+		log.Printf("Failed to generate report for user %d: %v", user.UserID, err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, reportErrorText(locale, "report.error", err)))
+		return
+	}
+
+	if err := s.sendReportPages(message.Chat.ID, userReport.Pages()); err != nil {
+		log.Printf("Failed to send report for user %d: %v", user.UserID, err)
+		s.tgBot.Send(tgbotapi.NewMessage(message.Chat.ID, i18n.T(locale, "report.send_failed")))
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/i18n"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserReport(t *testing.T) {
+	ctx := context.Background()
+	userID := 123
+
+	userReportMessage := func(text string) *tgbotapi.Message {
+		return &tgbotapi.Message{
+			Text:     text,
+			Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/userreport")}},
+			From:     &tgbotapi.User{ID: userID},
+			Chat:     &tgbotapi.Chat{ID: 5, Type: "private"},
+		}
+	}
+
+	t.Run("Usage without username", func(t *testing.T) {
+		_, mockTgBot, wardenBotService := setupTest()
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return strings.HasPrefix(c.Text, "Укажите пользователя")
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.processUserReportCommand(ctx, userReportMessage("/userreport"), i18n.DefaultLocale)
+		mockTgBot.AssertExpectations(t)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		mockStorage.On("GetUserByUsername", ctx, "jdoe").Return(nil, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return strings.HasPrefix(c.Text, "Пользователь @jdoe не найден")
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.processUserReportCommand(ctx, userReportMessage("/userreport @jdoe"), i18n.DefaultLocale)
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+	})
+
+	t.Run("Report covers only admin chats", func(t *testing.T) {
+		mockStorage, mockTgBot, wardenBotService := setupTest()
+		mockStorage.On("GetUserByUsername", ctx, "jdoe").Return(&model.User{UserID: 7, Username: "jdoe", FullName: "John Doe"}, nil)
+		mockStorage.On("GetGroupChats", ctx).Return([]model.Chat{{ChatID: -1, Title: "Chat 1"}, {ChatID: -2, Title: "Chat 2"}}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -1}).Return([]tgbotapi.ChatMember{{User: &tgbotapi.User{ID: userID}}}, nil)
+		mockTgBot.On("GetChatAdministrators", tgbotapi.ChatConfig{ChatID: -2}).Return([]tgbotapi.ChatMember{}, nil)
+		mockStorage.On("GetChatSettings", ctx, int64(-1)).Return(model.DefaultChatSettings(-1), nil)
+		mockStorage.On("GetMessagesByUserAndPeriod", ctx, 7, int64(-1), mock.Anything, mock.Anything).Return([]*model.Message{
+			{MessageID: 1, UserID: 7, Text: "lol", Label: 0, Confidence: 1, Status: model.MessageStatusClassified},
+		}, nil)
+		mockTgBot.On("Send", mock.MatchedBy(func(c tgbotapi.MessageConfig) bool {
+			return strings.Contains(c.Text, "John Doe (@jdoe)") && strings.Contains(c.Text, "- Chat 1: 1 сообщений")
+		})).Return(tgbotapi.Message{}, nil)
+
+		wardenBotService.processUserReportCommand(ctx, userReportMessage("/userreport @jdoe month"), i18n.DefaultLocale)
+		mockStorage.AssertExpectations(t)
+		mockTgBot.AssertExpectations(t)
+	})
+}
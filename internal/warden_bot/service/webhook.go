@@ -0,0 +1,73 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	maxUpdateSize     = 1 << 20
+)
+
+type WebhookConfig struct {
+	HttpAddr string
+	Path     string
+	Secret   string
+}
+
+type WebhookHandler struct {
+	secret  string
+	updates chan tgbotapi.Update
+}
+
+func NewWebhookHandler(secret string, buffer int) *WebhookHandler {
+	return &WebhookHandler{
+		secret:  secret,
+		updates: make(chan tgbotapi.Update, buffer),
+	}
+}
+
+func (h *WebhookHandler) Updates() tgbotapi.UpdatesChannel {
+	return h.updates
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Telegram echoes the secret_token passed to setWebhook in this header, without a secret nothing is accepted
+	if h.secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(h.secret)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxUpdateSize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.Unmarshal(body, &update); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram will redeliver the update if we do not answer with 2xx
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const recordedUpdate = `{
+	"update_id": 10001,
+	"message": {
+		"message_id": 42,
+		"from": {"id": 7, "first_name": "John", "last_name": "Doe"},
+		"chat": {"id": -100, "type": "group", "title": "Team"},
+		"date": 1733050000,
+		"text": "Hello, World!"
+	}
+}`
+
+func TestWebhookHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		handler := NewWebhookHandler("secret", 1)
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(recordedUpdate))
+		req.Header.Set(secretTokenHeader, "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		update := <-handler.Updates()
+		assert.Equal(t, 10001, update.UpdateID)
+		assert.Equal(t, "Hello, World!", update.Message.Text)
+		assert.Equal(t, int64(-100), update.Message.Chat.ID)
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		handler := NewWebhookHandler("secret", 1)
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(recordedUpdate))
+		req.Header.Set(secretTokenHeader, "wrong")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, 0, len(handler.Updates()))
+	})
+
+	t.Run("No secret configured", func(t *testing.T) {
+		handler := NewWebhookHandler("", 1)
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id": 1}`))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, 0, len(handler.Updates()))
+	})
+
+	t.Run("Malformed body", func(t *testing.T) {
+		handler := NewWebhookHandler("secret", 1)
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{"))
+		req.Header.Set(secretTokenHeader, "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -23,3 +23,8 @@ func (m *MockTgBotAPI) GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbo
 	args := m.Called(config)
 	return args.Get(0).([]tgbotapi.ChatMember), args.Error(1)
 }
+
+func (m *MockTgBotAPI) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	args := m.Called(config)
+	return args.Get(0).(tgbotapi.APIResponse), args.Error(1)
+}
@@ -0,0 +1,16 @@
+package classifier
+
+import (
+	"context"
+	"github.com/g3ksa/warden_bot/internal/warden_bot/service/model"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockClassifier struct {
+	mock.Mock
+}
+
+func (m *MockClassifier) Classify(ctx context.Context, messages []model.MessageRequest) ([]model.ClassifiedMessage, error) {
+	args := m.Called(ctx, messages)
+	return args.Get(0).([]model.ClassifiedMessage), args.Error(1)
+}
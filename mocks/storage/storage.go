@@ -16,13 +16,38 @@ func (m *MockStorage) PutMessage(ctx context.Context, message *model.Message) er
 	return args.Error(0)
 }
 
+func (m *MockStorage) EditMessage(ctx context.Context, chatID int64, messageID uint64, text, caption string, editedAt time.Time) error {
+	args := m.Called(ctx, chatID, messageID, text, caption, editedAt)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetMessageThreadID(ctx context.Context, chatID int64, messageID uint64) (uint64, error) {
+	args := m.Called(ctx, chatID, messageID)
+	return args.Get(0).(uint64), args.Error(1)
+}
+
+func (m *MockStorage) MigrateChat(ctx context.Context, fromChatID, toChatID int64) error {
+	args := m.Called(ctx, fromChatID, toChatID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) DeactivateChat(ctx context.Context, chatID int64) error {
+	args := m.Called(ctx, chatID)
+	return args.Error(0)
+}
+
 func (m *MockStorage) UpdateMessages(ctx context.Context, messages []*model.Message) error {
 	args := m.Called(ctx, messages)
 	return args.Error(0)
 }
 
-func (m *MockStorage) GetMessagesForLastDayByChat(ctx context.Context, chatID uint64) ([]model.Message, error) {
-	args := m.Called(ctx, chatID)
+func (m *MockStorage) GetMessagesAfterWatermark(ctx context.Context, watermark *model.ClassificationWatermark) ([]model.Message, error) {
+	args := m.Called(ctx, watermark)
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockStorage) GetMessagesByChatAndRange(ctx context.Context, chatID int64, from, to time.Time) ([]model.Message, error) {
+	args := m.Called(ctx, chatID, from, to)
 	return args.Get(0).([]model.Message), args.Error(1)
 }
 
@@ -36,12 +61,98 @@ func (m *MockStorage) GetGroupChats(ctx context.Context) ([]model.Chat, error) {
 	return args.Get(0).([]model.Chat), args.Error(1)
 }
 
-func (m *MockStorage) GetMessagesByChatAndPeriod(ctx context.Context, chatID uint64, date time.Time) ([]*model.Message, error) {
-	args := m.Called(ctx, chatID, date)
+func (m *MockStorage) GetMessagesByChatAndPeriod(ctx context.Context, chatID int64, from, to time.Time) ([]*model.Message, error) {
+	args := m.Called(ctx, chatID, from, to)
 	return args.Get(0).([]*model.Message), args.Error(1)
 }
 
-func (m *MockStorage) GetChatInfoByID(ctx context.Context, chatID uint64) (*model.Chat, error) {
+func (m *MockStorage) GetChatInfoByID(ctx context.Context, chatID int64) (*model.Chat, error) {
 	args := m.Called(ctx, chatID)
 	return args.Get(0).(*model.Chat), args.Error(1)
 }
+
+func (m *MockStorage) GetUpdateOffset(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) SaveUpdateOffset(ctx context.Context, updateID int) error {
+	args := m.Called(ctx, updateID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetClassificationWatermark(ctx context.Context, chatID int64) (*model.ClassificationWatermark, error) {
+	args := m.Called(ctx, chatID)
+	return args.Get(0).(*model.ClassificationWatermark), args.Error(1)
+}
+
+func (m *MockStorage) SaveClassificationWatermark(ctx context.Context, watermark *model.ClassificationWatermark) error {
+	args := m.Called(ctx, watermark)
+	return args.Error(0)
+}
+
+func (m *MockStorage) SaveSubscription(ctx context.Context, subscription *model.Subscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *MockStorage) DeleteSubscription(ctx context.Context, userID int, chatID int64) error {
+	args := m.Called(ctx, userID, chatID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetSubscriptions(ctx context.Context) ([]model.Subscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.Subscription), args.Error(1)
+}
+
+func (m *MockStorage) GetUserSubscriptions(ctx context.Context, userID int) ([]model.Subscription, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]model.Subscription), args.Error(1)
+}
+
+func (m *MockStorage) MarkSubscriptionSent(ctx context.Context, userID int, chatID int64, sentAt time.Time) error {
+	args := m.Called(ctx, userID, chatID, sentAt)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetChatSettings(ctx context.Context, chatID int64) (*model.ChatSettings, error) {
+	args := m.Called(ctx, chatID)
+	return args.Get(0).(*model.ChatSettings), args.Error(1)
+}
+
+func (m *MockStorage) SaveChatSettings(ctx context.Context, settings *model.ChatSettings) error {
+	args := m.Called(ctx, settings)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetUserLocale(ctx context.Context, userID int) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) SaveUserLocale(ctx context.Context, userID int, locale string) error {
+	args := m.Called(ctx, userID, locale)
+	return args.Error(0)
+}
+
+func (m *MockStorage) SaveUser(ctx context.Context, user *model.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetUsersByIDs(ctx context.Context, userIDs []int) ([]model.User, error) {
+	args := m.Called(ctx, userIDs)
+	return args.Get(0).([]model.User), args.Error(1)
+}
+
+func (m *MockStorage) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	args := m.Called(ctx, username)
+	user, _ := args.Get(0).(*model.User)
+	return user, args.Error(1)
+}
+
+func (m *MockStorage) GetMessagesByUserAndPeriod(ctx context.Context, userID int, chatID int64, from, to time.Time) ([]*model.Message, error) {
+	args := m.Called(ctx, userID, chatID, from, to)
+	return args.Get(0).([]*model.Message), args.Error(1)
+}